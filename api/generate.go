@@ -0,0 +1,3 @@
+package api
+
+//go:generate protoc --go_out=plugins=grpc:. ipsec.proto
@@ -0,0 +1,195 @@
+package arp
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/arp"
+	"github.com/mdlayher/ethernet"
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+)
+
+const (
+	// DefaultAnnounceRate is the default number of gratuitous ARPs sent per second
+	DefaultAnnounceRate = 10
+
+	// DefaultAnnounceBurst is the default number of gratuitous ARPs sent at once
+	DefaultAnnounceBurst = 20
+
+	announceQueueSize = 1024
+)
+
+// announcement is a gratuitous ARP to send on every interface, with the MAC
+// of the interface when mac is nil
+type announcement struct {
+	ip  net.IP
+	mac net.HardwareAddr
+}
+
+// announce sends gratuitous ARPs for the entries of the network which
+// became remote, so the neighbors point them at the proxy, and for the
+// ones which became local, so the neighbors point them back at the
+// container. The store is compared with the entries seen last on the
+// entry events and every Resync, so a dropped event only delays the
+// announcement. The announcements are limited to AnnounceRate per second
+// with bursts of AnnounceBurst.
+func (p *Proxy) announce() {
+	q := make(chan announcement, announceQueueSize)
+	c, cancel := events.Subscribe()
+	defer cancel()
+	resync := time.NewTicker(p.Resync)
+	defer resync.Stop()
+
+	// The entries already known when the agent starts may have been
+	// announced by another host in the meantime
+	known := remoteEntries(p.db)
+	for ip := range known {
+		if a := net.ParseIP(ip).To4(); a != nil && len(q) < cap(q) {
+			q <- announcement{ip: a}
+		}
+	}
+	go p.sendAnnouncements(q)
+
+	for {
+		select {
+		case event := <-c:
+			if !p.ownEvent(event) {
+				continue
+			}
+			switch event.Type {
+			case events.EntryRemote, events.EntryLocal:
+			default:
+				continue
+			}
+		case <-resync.C:
+		case <-p.stop:
+			return
+		}
+
+		var moves []announcement
+		moves, known = announcements(p.db, known)
+		for _, a := range moves {
+			select {
+			case q <- a:
+			default:
+				log.Errorf("arp: announcement queue is full, dropping announcement for %s", a.ip)
+			}
+		}
+	}
+}
+
+// remoteEntries returns the remote IPv4 entries of the store
+func remoteEntries(db store.Store) map[string]store.Entry {
+	remote := map[string]store.Entry{}
+	for ip, e := range db.RemoteEntriesMap() {
+		if net.ParseIP(ip).To4() != nil {
+			remote[ip] = e
+		}
+	}
+	return remote
+}
+
+// announcements returns the announcements of the IPv4 entries which became
+// remote or moved to this host since the known remote entries, with the
+// remote entries of the store
+func announcements(db store.Store, known map[string]store.Entry) ([]announcement, map[string]store.Entry) {
+	remote := remoteEntries(db)
+	moves := []announcement{}
+	for ip, e := range remote {
+		if old, ok := known[ip]; !ok || old.HostIPAddress != e.HostIPAddress {
+			moves = append(moves, announcement{ip: net.ParseIP(ip).To4()})
+		}
+	}
+
+	localHostIP := db.LocalHostIPAddress()
+	for _, e := range db.Entries() {
+		ip := strings.Split(e.IPAddress, "/")[0]
+		if _, ok := known[ip]; !ok || e.HostIPAddress != localHostIP {
+			continue
+		}
+		mac, _ := net.ParseMAC(e.MACAddress)
+		if mac == nil {
+			log.Debugf("arp: not announcing %s, its MAC address is unknown", ip)
+			continue
+		}
+		moves = append(moves, announcement{ip: net.ParseIP(ip).To4(), mac: mac})
+	}
+	return moves, remote
+}
+
+func (p *Proxy) sendAnnouncements(q <-chan announcement) {
+	tokens := p.AnnounceBurst
+	refill := time.NewTicker(time.Second / time.Duration(p.AnnounceRate))
+	defer refill.Stop()
+
+	clients := map[string]*arp.Client{}
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	for {
+		if tokens == 0 {
+			select {
+			case <-refill.C:
+			case <-p.stop:
+				return
+			}
+			tokens++
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-refill.C:
+			if tokens < p.AnnounceBurst {
+				tokens++
+			}
+		case a := <-q:
+			tokens--
+			for _, ifaceName := range p.Interfaces {
+				if err := sendAnnouncement(clients, ifaceName, a); err != nil {
+					log.Errorf("arp: couldn't announce %s on %s: %v", a.ip, ifaceName, err)
+				}
+			}
+		}
+	}
+}
+
+// sendAnnouncement broadcasts an unsolicited reply for the announced IP,
+// reusing the client of the interface from the earlier announcements
+func sendAnnouncement(clients map[string]*arp.Client, ifaceName string, a announcement) error {
+	client, ok := clients[ifaceName]
+	if !ok {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return err
+		}
+		client, err = arp.NewClient(iface)
+		if err != nil {
+			return err
+		}
+		clients[ifaceName] = client
+	}
+
+	mac := a.mac
+	if mac == nil {
+		mac = client.HardwareAddr()
+	}
+
+	packet, err := arp.NewPacket(arp.OperationReply, mac, a.ip, ethernet.Broadcast, a.ip)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Announcing %s at %s on %s", a.ip, mac, ifaceName)
+	if err := client.WriteTo(packet, ethernet.Broadcast); err != nil {
+		client.Close()
+		delete(clients, ifaceName)
+		return err
+	}
+	return nil
+}
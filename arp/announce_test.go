@@ -0,0 +1,72 @@
+package arp
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rancher/ipsec/store"
+)
+
+// entriesStore serves the entries as seen from the host 192.168.0.1
+type entriesStore struct {
+	store.Store
+	entries []store.Entry
+}
+
+func (s *entriesStore) LocalHostIPAddress() string {
+	return "192.168.0.1"
+}
+
+func (s *entriesStore) Entries() []store.Entry {
+	return s.entries
+}
+
+func (s *entriesStore) RemoteEntriesMap() map[string]store.Entry {
+	remote := map[string]store.Entry{}
+	for _, e := range s.entries {
+		if e.HostIPAddress != s.LocalHostIPAddress() {
+			remote[e.IPAddress] = e
+		}
+	}
+	return remote
+}
+
+func TestAnnouncements(t *testing.T) {
+	db := &entriesStore{entries: []store.Entry{
+		{IPAddress: "10.42.0.2", HostIPAddress: "192.168.0.2"},
+		{IPAddress: "10.42.0.3", HostIPAddress: "192.168.0.3"},
+		{IPAddress: "10.42.0.4", HostIPAddress: "192.168.0.2"},
+		{IPAddress: "fd00::2", HostIPAddress: "192.168.0.2"},
+	}}
+	known := remoteEntries(db)
+	if len(known) != 3 {
+		t.Fatalf("expected the 3 remote IPv4 entries, got %v", known)
+	}
+
+	// Several refreshes happened meanwhile, their events were dropped:
+	// 10.42.0.2 moved to another host, 10.42.0.3 to this one, 10.42.0.4
+	// is gone and 10.42.0.5 is new
+	db.entries = []store.Entry{
+		{IPAddress: "10.42.0.2", HostIPAddress: "192.168.0.3"},
+		{IPAddress: "10.42.0.3/16", HostIPAddress: "192.168.0.1", MACAddress: "02:00:0a:2a:00:03"},
+		{IPAddress: "10.42.0.5", HostIPAddress: "192.168.0.2"},
+		{IPAddress: "10.42.0.6", HostIPAddress: "192.168.0.1", MACAddress: "02:00:0a:2a:00:06"},
+	}
+	moves, known := announcements(db, known)
+
+	got := []string{}
+	for _, a := range moves {
+		got = append(got, a.ip.String()+" "+a.mac.String())
+	}
+	sort.Strings(got)
+	expected := []string{"10.42.0.2 ", "10.42.0.3 02:00:0a:2a:00:03", "10.42.0.5 "}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Nothing changed since
+	if moves, _ := announcements(db, known); len(moves) != 0 {
+		t.Errorf("unexpected announcements %v", moves)
+	}
+}
@@ -6,12 +6,14 @@ import (
 
 	"github.com/mdlayher/arp"
 	"github.com/mdlayher/ethernet"
-	"github.com/rancher/ipsec/store"
 	"github.com/rancher/log"
 )
 
-// ListenAndServe starts ARP proxy server
-func ListenAndServe(db store.Store, ifaceName string) error {
+// ListenAndServe starts ARP proxy server on a single interface. It only
+// returns when the interface can't be opened or read from anymore or the
+// proxy stopped, failures to send a reply are logged and the next request
+// is served.
+func (p *Proxy) ListenAndServe(ifaceName string) error {
 	listenIface, err := net.InterfaceByName(ifaceName)
 	if err != nil {
 		return err
@@ -21,27 +23,68 @@ func ListenAndServe(db store.Store, ifaceName string) error {
 	if err != nil {
 		return err
 	}
+	if err := p.listening(client); err != nil {
+		return err
+	}
+	defer p.closed(client)
+	defer client.Close()
 
 	log.Infof("Listening for ARP requests on %s", ifaceName)
 	for {
+		if err := p.nextRead(client); err != nil {
+			return err
+		}
 		arpRequest, iface, err := client.Read()
+		if timedOut(err) {
+			continue
+		}
 		if err != nil {
 			return err
 		}
 
-		if arpRequest.Operation != arp.OperationRequest ||
-			(!bytes.Equal(iface.Destination, ethernet.Broadcast) &&
-				!bytes.Equal(iface.Destination, listenIface.HardwareAddr)) {
-			continue
-		}
+		p.serveRequest(listenIface, arpRequest, iface, func() error {
+			return client.Reply(arpRequest, listenIface.HardwareAddr, arpRequest.TargetIP)
+		})
+	}
+}
+
+// serveRequest answers the ARP request with reply when its target is
+// remote. Every ARP packet is checked for conflicts with the store first.
+func (p *Proxy) serveRequest(listenIface *net.Interface, arpRequest *arp.Packet, iface *ethernet.Frame, reply func() error) {
+	p.checkConflict(listenIface, arpRequest)
+
+	if arpRequest.Operation != arp.OperationRequest {
+		return
+	}
+
+	targetIP := arpRequest.TargetIP.String()
+	log.Debugf("Arp request for %s", targetIP)
+	d := Decision{
+		Interface:    listenIface.Name,
+		RequesterIP:  arpRequest.SenderIP.String(),
+		RequesterMAC: arpRequest.SenderHardwareAddr.String(),
+		Target:       targetIP,
+	}
 
-		targetIP := arpRequest.TargetIP.String()
-		log.Debugf("Arp request for %s", targetIP)
-		if db.IsRemote(targetIP) {
-			log.Debugf("Sending arp reply for %s", targetIP)
-			if err := client.Reply(arpRequest, listenIface.HardwareAddr, arpRequest.TargetIP); err != nil {
-				return err
-			}
+	switch {
+	case !bytes.Equal(iface.Destination, ethernet.Broadcast) &&
+		!bytes.Equal(iface.Destination, listenIface.HardwareAddr):
+		d.Decision = DecisionNotBroadcast
+	case p.db.IsLocal(targetIP):
+		d.Decision = DecisionLocal
+	case !p.db.IsRemote(targetIP):
+		d.Decision = DecisionUnknown
+	case p.BlockConflicts && p.conflicts.has(targetIP):
+		log.Debugf("Not answering for conflicted %s", targetIP)
+		d.Decision = DecisionConflict
+	default:
+		log.Debugf("Sending arp reply for %s", targetIP)
+		d.Decision = DecisionReply
+		if err := reply(); err != nil {
+			log.Errorf("arp: couldn't reply to %s for %s on %s: %v", d.RequesterIP, targetIP, listenIface.Name, err)
+			d.Decision = DecisionError
 		}
 	}
+
+	p.stats.record(d)
 }
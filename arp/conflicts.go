@@ -0,0 +1,237 @@
+package arp
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/arp"
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+)
+
+const (
+	// ConflictDuplicate is an IP used by containers on different hosts
+	ConflictDuplicate = events.ConflictDuplicate
+
+	// ConflictRemoteClaimed is an IP the store places on a remote host
+	// which a device on the local interface uses
+	ConflictRemoteClaimed = events.ConflictRemoteClaimed
+
+	// conflicts seen on the interfaces which weren't seen again for that
+	// long are forgotten, the duplicates last until the store resolves
+	// them
+	conflictTTL = 10 * time.Minute
+)
+
+// Conflict is an IP address claimed by more than one container
+type Conflict struct {
+	IP                string    `json:"ip"`
+	Kind              string    `json:"kind"`
+	Interface         string    `json:"interface,omitempty"`
+	MAC               string    `json:"mac,omitempty"`
+	HostIP            string    `json:"hostIp,omitempty"`
+	ConflictingHostIP string    `json:"conflictingHostIp,omitempty"`
+	FirstSeen         time.Time `json:"firstSeen"`
+	LastSeen          time.Time `json:"lastSeen"`
+	Count             int       `json:"count"`
+}
+
+type conflicts struct {
+	sync.Mutex
+
+	byKey map[string]*Conflict
+
+	// detected counts the new conflicts per kind
+	detected map[string]uint64
+}
+
+func newConflicts() *conflicts {
+	return &conflicts{
+		byKey:    map[string]*Conflict{},
+		detected: map[string]uint64{},
+	}
+}
+
+// record stores the conflict and reports whether it's a new one, which is
+// then counted
+func (cs *conflicts) record(c Conflict) bool {
+	cs.Lock()
+	defer cs.Unlock()
+
+	now := time.Now().UTC()
+	key := c.Kind + "/" + c.IP
+	existing, ok := cs.byKey[key]
+	if ok && !existing.expired(now) &&
+		existing.MAC == c.MAC && existing.ConflictingHostIP == c.ConflictingHostIP {
+		existing.LastSeen = now
+		existing.Count++
+		return false
+	}
+
+	c.FirstSeen = now
+	c.LastSeen = now
+	c.Count = 1
+	cs.byKey[key] = &c
+	cs.detected[c.Kind]++
+	return true
+}
+
+// expired reports whether the conflict was last seen on an interface too
+// long ago
+func (c *Conflict) expired(now time.Time) bool {
+	return c.Kind != ConflictDuplicate && now.Sub(c.LastSeen) >= conflictTTL
+}
+
+// setDuplicates records the new duplicates found by the store, and the
+// ones now on other hosts, and forgets the ones it doesn't report anymore
+func (cs *conflicts) setDuplicates(duplicates map[string]store.Duplicate) {
+	cs.Lock()
+	defer cs.Unlock()
+
+	for key, c := range cs.byKey {
+		if _, ok := duplicates[c.IP]; c.Kind == ConflictDuplicate && !ok {
+			delete(cs.byKey, key)
+		}
+	}
+
+	now := time.Now().UTC()
+	for ip, d := range duplicates {
+		key := ConflictDuplicate + "/" + ip
+		if c, ok := cs.byKey[key]; ok && c.HostIP == d.HostIPAddress &&
+			c.ConflictingHostIP == d.ConflictingHostIPAddress {
+			continue
+		}
+		cs.byKey[key] = &Conflict{
+			IP:                ip,
+			Kind:              ConflictDuplicate,
+			HostIP:            d.HostIPAddress,
+			ConflictingHostIP: d.ConflictingHostIPAddress,
+			FirstSeen:         now,
+			LastSeen:          now,
+			Count:             1,
+		}
+		cs.detected[ConflictDuplicate]++
+	}
+}
+
+func (cs *conflicts) counters() map[string]uint64 {
+	cs.Lock()
+	defer cs.Unlock()
+
+	result := map[string]uint64{}
+	for kind, count := range cs.detected {
+		result[kind] = count
+	}
+	return result
+}
+
+// has reports whether the IP is involved in a current conflict
+func (cs *conflicts) has(ip string) bool {
+	cs.Lock()
+	defer cs.Unlock()
+
+	now := time.Now()
+	for _, c := range cs.byKey {
+		if c.IP == ip && !c.expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *conflicts) list() []Conflict {
+	cs.Lock()
+	defer cs.Unlock()
+
+	now := time.Now()
+	result := []Conflict{}
+	for key, c := range cs.byKey {
+		if c.expired(now) {
+			delete(cs.byKey, key)
+			continue
+		}
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].IP != result[j].IP {
+			return result[i].IP < result[j].IP
+		}
+		return result[i].Kind < result[j].Kind
+	})
+	return result
+}
+
+// Conflicts returns the current IP conflicts
+func (p *Proxy) Conflicts() []Conflict {
+	return p.conflicts.list()
+}
+
+// ConflictCounters returns the number of conflicts detected per kind since
+// the proxy started
+func (p *Proxy) ConflictCounters() map[string]uint64 {
+	return p.conflicts.counters()
+}
+
+// checkConflict flags the sender of an ARP packet seen on the local
+// interface using an IP which the store places on another host
+func (p *Proxy) checkConflict(listenIface *net.Interface, packet *arp.Packet) {
+	if packet.SenderIP.IsUnspecified() ||
+		bytes.Equal(packet.SenderHardwareAddr, listenIface.HardwareAddr) {
+		return
+	}
+
+	ip := packet.SenderIP.String()
+	if !p.db.IsRemote(ip) {
+		return
+	}
+
+	c := Conflict{
+		IP:        ip,
+		Kind:      ConflictRemoteClaimed,
+		Interface: listenIface.Name,
+		MAC:       packet.SenderHardwareAddr.String(),
+		HostIP:    p.db.RemoteEntriesMap()[ip].HostIPAddress,
+	}
+	if p.conflicts.record(c) {
+		log.Errorf("arp: %s on %s claims %s which belongs to host %s", c.MAC, c.Interface, ip, c.HostIP)
+		data := map[string]string{
+			"ip":        ip,
+			"kind":      c.Kind,
+			"interface": c.Interface,
+			"mac":       c.MAC,
+			"hostIp":    c.HostIP,
+		}
+		if p.Network != "" {
+			data[events.NetworkKey] = p.Network
+		}
+		events.Publish(events.IPConflict, data)
+	}
+}
+
+// trackConflicts keeps the duplicate IPs found by the store of the proxy,
+// they are read from the store again whenever they change
+func (p *Proxy) trackConflicts() {
+	c, cancel := events.Subscribe()
+	defer cancel()
+
+	p.conflicts.setDuplicates(p.db.Duplicates())
+	for {
+		var event events.Event
+		select {
+		case event = <-c:
+		case <-p.stop:
+			return
+		}
+
+		if !p.ownEvent(event) || event.Data["kind"] != ConflictDuplicate {
+			continue
+		}
+		if event.Type == events.IPConflict || event.Type == events.IPConflictResolved {
+			p.conflicts.setDuplicates(p.db.Duplicates())
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package arp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/ipsec/store"
+)
+
+func TestSetDuplicates(t *testing.T) {
+	cs := newConflicts()
+	dup := store.Duplicate{HostIPAddress: "192.168.0.1", ConflictingHostIPAddress: "192.168.0.2"}
+
+	cs.setDuplicates(map[string]store.Duplicate{"10.42.0.5": dup})
+	cs.setDuplicates(map[string]store.Duplicate{"10.42.0.5": dup})
+	if got := cs.counters()[ConflictDuplicate]; got != 1 {
+		t.Errorf("expected the duplicate to be counted once, got %d", got)
+	}
+
+	// Duplicates don't expire while the store reports them
+	cs.byKey[ConflictDuplicate+"/10.42.0.5"].LastSeen = time.Now().Add(-2 * conflictTTL)
+	if !cs.has("10.42.0.5") || len(cs.list()) != 1 {
+		t.Error("expected the duplicate to last")
+	}
+
+	moved := store.Duplicate{HostIPAddress: "192.168.0.1", ConflictingHostIPAddress: "192.168.0.3"}
+	cs.setDuplicates(map[string]store.Duplicate{"10.42.0.5": moved})
+	if got := cs.counters()[ConflictDuplicate]; got != 2 {
+		t.Errorf("expected the duplicate on another host to be counted, got %d", got)
+	}
+
+	cs.setDuplicates(map[string]store.Duplicate{})
+	if cs.has("10.42.0.5") || len(cs.list()) != 0 {
+		t.Error("expected the resolved duplicate to be forgotten")
+	}
+}
+
+func TestConflictExpiry(t *testing.T) {
+	cs := newConflicts()
+	c := Conflict{IP: "10.42.0.6", Kind: ConflictRemoteClaimed, MAC: "02:00:00:00:00:01"}
+	if !cs.record(c) || cs.record(c) {
+		t.Error("expected only the first sighting to be new")
+	}
+
+	cs.byKey[ConflictRemoteClaimed+"/10.42.0.6"].LastSeen = time.Now().Add(-2 * conflictTTL)
+	if cs.has("10.42.0.6") {
+		t.Error("expected the conflict not seen again to expire")
+	}
+	if !cs.record(c) {
+		t.Error("expected the expired conflict to be new again")
+	}
+}
@@ -0,0 +1,209 @@
+package arp
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mdlayher/arp"
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	// ModeSocket reads every ARP request seen on the interface
+	ModeSocket = "socket"
+
+	// ModeBPF attaches a filter to the socket so only the requests for
+	// remote entries wake the proxy up
+	ModeBPF = "bpf"
+
+	// Offsets in the ethernet frame of the ARP operation and target IP
+	arpOperationOffset = 14 + 6
+	arpTargetIPOffset  = 14 + 24
+
+	// The kernel refuses filters longer than 4096 instructions, the
+	// program needs two per target plus the header and trailer
+	maxFilteredTargets = 2000
+
+	acceptLen = 0xffff
+)
+
+// ListenAndServeFiltered is ListenAndServe with a BPF filter matching the
+// remote entries attached to the socket. The filter is rebuilt whenever
+// entries become remote, local or are removed from the store, so requests
+// for local or unknown targets never leave the kernel. It's also checked
+// against the store every Resync, in case the broker dropped the events. Replies and the
+// requests filtered out aren't checked for conflicts, nor counted in the
+// stats of the interface.
+func (p *Proxy) ListenAndServeFiltered(ifaceName string) error {
+	listenIface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return err
+	}
+
+	conn, err := raw.ListenPacket(listenIface, raw.ProtocolARP)
+	if err != nil {
+		return err
+	}
+	if err := p.listening(conn); err != nil {
+		return err
+	}
+	defer p.closed(conn)
+	defer conn.Close()
+
+	c, cancel := events.Subscribe()
+	defer cancel()
+
+	targets, err := setFilter(conn, p.db, nil)
+	if err != nil {
+		return err
+	}
+	p.stats.filtered(ifaceName)
+	go func() {
+		resync := time.NewTicker(p.Resync)
+		defer resync.Stop()
+		for {
+			select {
+			case event, ok := <-c:
+				if !ok {
+					return
+				}
+				if !p.ownEvent(event) {
+					continue
+				}
+				switch event.Type {
+				case events.EntryRemote, events.EntryLocal, events.EntryRemoved:
+				default:
+					continue
+				}
+			case <-resync.C:
+			}
+
+			var err error
+			if targets, err = setFilter(conn, p.db, targets); err != nil {
+				log.Errorf("arp: couldn't update the filter on %s: %v", ifaceName, err)
+			}
+		}
+	}()
+
+	log.Infof("Listening for filtered ARP requests on %s", ifaceName)
+	b := make([]byte, listenIface.MTU+14)
+	for {
+		if err := p.nextRead(conn); err != nil {
+			return err
+		}
+		n, _, err := conn.ReadFrom(b)
+		if timedOut(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		iface := &ethernet.Frame{}
+		if err := iface.UnmarshalBinary(b[:n]); err != nil {
+			continue
+		}
+		arpRequest := &arp.Packet{}
+		if err := arpRequest.UnmarshalBinary(iface.Payload); err != nil {
+			continue
+		}
+
+		p.serveRequest(listenIface, arpRequest, iface, func() error {
+			return writeReply(conn, listenIface.HardwareAddr, arpRequest)
+		})
+	}
+}
+
+// setFilter attaches the filter for the current remote entries, unless
+// they are the installed ones, and returns the targets it matches
+func setFilter(conn *raw.Conn, db store.Store, installed []string) ([]string, error) {
+	targets := []string{}
+	for ip := range db.RemoteEntriesMap() {
+		if net.ParseIP(ip).To4() != nil {
+			targets = append(targets, ip)
+		}
+	}
+	sort.Strings(targets)
+
+	if installed != nil && equalTargets(targets, installed) {
+		return installed, nil
+	}
+
+	filter, err := bpf.Assemble(remoteTargetsFilter(targets))
+	if err != nil {
+		return installed, err
+	}
+	if err := conn.SetBPF(filter); err != nil {
+		return installed, err
+	}
+
+	log.Debugf("arp: filtering requests for %d remote targets", len(targets))
+	return targets, nil
+}
+
+// remoteTargetsFilter matches the ARP requests for the given targets. When
+// there are too many of them to fit in a program every request is passed
+// up and the targets are checked against the store as in ModeSocket.
+func remoteTargetsFilter(targets []string) []bpf.Instruction {
+	program := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: arpOperationOffset, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(arp.OperationRequest), SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+	}
+	if len(targets) > maxFilteredTargets {
+		return append(program, bpf.RetConstant{Val: acceptLen})
+	}
+
+	program = append(program, bpf.LoadAbsolute{Off: arpTargetIPOffset, Size: 4})
+	for _, target := range targets {
+		program = append(program,
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: binary.BigEndian.Uint32(net.ParseIP(target).To4()), SkipFalse: 1},
+			bpf.RetConstant{Val: acceptLen},
+		)
+	}
+	return append(program, bpf.RetConstant{Val: 0})
+}
+
+func writeReply(conn *raw.Conn, mac net.HardwareAddr, arpRequest *arp.Packet) error {
+	packet, err := arp.NewPacket(arp.OperationReply, mac, arpRequest.TargetIP, arpRequest.SenderHardwareAddr, arpRequest.SenderIP)
+	if err != nil {
+		return err
+	}
+	payload, err := packet.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	f := &ethernet.Frame{
+		Destination: arpRequest.SenderHardwareAddr,
+		Source:      mac,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     payload,
+	}
+	frame, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.WriteTo(frame, &raw.Addr{HardwareAddr: arpRequest.SenderHardwareAddr})
+	return err
+}
+
+func equalTargets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
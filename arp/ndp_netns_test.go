@@ -0,0 +1,198 @@
+package arp
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+	"github.com/rancher/ipsec/store"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+const (
+	proxyVeth     = "ndp-proxy0"
+	requesterVeth = "ndp-req0"
+)
+
+// inNetns runs the test in a new network namespace holding a veth pair,
+// the proxy listening on one end and the requester on the other, until
+// the returned function is called. Like scripts/netns-static it needs
+// root and is skipped with SKIP_NETNS.
+func inNetns(t *testing.T) (netns.NsHandle, func()) {
+	if os.Getenv("SKIP_NETNS") != "" || os.Geteuid() != 0 {
+		t.Skip("network namespace tests need root")
+	}
+
+	runtime.LockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+	ns, err := netns.New()
+	if err != nil {
+		orig.Close()
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+	restore := func() {
+		netns.Set(orig)
+		orig.Close()
+		ns.Close()
+		runtime.UnlockOSThread()
+	}
+
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: proxyVeth},
+		PeerName:  requesterVeth,
+	}
+	if err := netlink.LinkAdd(veth); err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	requester, err := netlink.LinkByName(requesterVeth)
+	if err == nil {
+		err = netlink.LinkSetHardwareAddr(requester, requesterMAC)
+	}
+	for _, link := range []netlink.Link{veth, requester} {
+		if err == nil {
+			err = netlink.LinkSetUp(link)
+		}
+	}
+	if err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	return ns, restore
+}
+
+// netnsStore returns a store, read from a file in dir, placing targetIP on
+// a remote host
+func netnsStore(t *testing.T, dir string) store.Store {
+	file := path.Join(dir, "store.json")
+	content := `{
+		"self": {"ip": "fd00::1/64", "hostIp": "192.168.99.1", "self": true},
+		"entries": [
+			{"ip": "fd00::1/64", "hostIp": "192.168.99.1"},
+			{"ip": "fd00::2/64", "hostIp": "192.168.99.2"}
+		]
+	}`
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db := store.NewFileStore(file)
+	if err := db.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// advertised sends the solicitation until the proxy answers it with an
+// advertisement for target or the timeout expires
+func advertised(t *testing.T, conn *raw.Conn, solicitation []byte, target net.IP, timeout time.Duration) (*ethernet.Frame, bool) {
+	deadline := time.Now().Add(timeout)
+	b := make([]byte, 1500)
+	for time.Now().Before(deadline) {
+		if _, err := conn.WriteTo(solicitation, &raw.Addr{HardwareAddr: ethernet.Broadcast}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The raw socket spins on a read started past its deadline,
+		// every read gets a fresh one
+		readDeadline := time.Now().Add(200 * time.Millisecond)
+		for time.Now().Before(readDeadline) {
+			conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			n, _, err := conn.ReadFrom(b)
+			if err != nil {
+				break
+			}
+			f := &ethernet.Frame{}
+			if err := f.UnmarshalBinary(b[:n]); err != nil || f.EtherType != ethernet.EtherTypeIPv6 {
+				continue
+			}
+			p := f.Payload
+			if len(p) < ipv6HeaderLen+24 || p[6] != protocolICMPv6 {
+				continue
+			}
+			icmp := p[ipv6HeaderLen:]
+			if icmp[0] == icmpNeighborAdvertisement && net.IP(icmp[8:24]).Equal(target) {
+				return f, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func TestNDPProxyNetns(t *testing.T) {
+	ns, restore := inNetns(t)
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "ndp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := NewProxy(netnsStore(t, dir), []string{proxyVeth})
+	errs := make(chan error, 1)
+	go func() {
+		// The listener opens its socket in the namespace, its thread
+		// is dropped once it returns
+		runtime.LockOSThread()
+		if err := netns.Set(ns); err != nil {
+			errs <- err
+			return
+		}
+		errs <- p.ListenAndServeNDP(proxyVeth)
+	}()
+	defer func() {
+		p.Stop()
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Error("the proxy didn't stop")
+		}
+	}()
+
+	iface, err := net.InterfaceByName(requesterVeth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyIface, err := net.InterfaceByName(proxyVeth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := raw.ListenPacket(iface, raw.Protocol(ethernet.EtherTypeIPv6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	f, ok := advertised(t, conn, solicitation(t, requesterIP, targetIP), targetIP, 5*time.Second)
+	if !ok {
+		select {
+		case err := <-errs:
+			t.Fatalf("proxy stopped: %v", err)
+		default:
+		}
+		t.Fatal("no advertisement received for the remote entry")
+	}
+	if f.Source.String() != proxyIface.HardwareAddr.String() || f.Destination.String() != requesterMAC.String() {
+		t.Errorf("unexpected advertisement %s -> %s", f.Source, f.Destination)
+	}
+
+	// Local entries and duplicate address detection probes are left to
+	// the containers
+	local := net.ParseIP("fd00::1")
+	if _, ok := advertised(t, conn, solicitation(t, requesterIP, local), local, time.Second); ok {
+		t.Error("unexpected advertisement for the local entry")
+	}
+	if _, ok := advertised(t, conn, solicitation(t, net.IPv6unspecified, targetIP), targetIP, time.Second); ok {
+		t.Error("unexpected advertisement for a duplicate address detection probe")
+	}
+}
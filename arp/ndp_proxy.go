@@ -0,0 +1,224 @@
+package arp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/log"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	ipv6HeaderLen  = 40
+	protocolICMPv6 = 58
+	ndpHopLimit    = 255
+
+	icmpNeighborSolicitation  = 135
+	icmpNeighborAdvertisement = 136
+
+	ndpOptionTargetLinkAddr = 2
+
+	// Offsets in the ethernet frame of the IPv6 next header and hop limit,
+	// and of the ICMPv6 type
+	ipv6NextHeaderOffset = 14 + 6
+	icmpTypeOffset       = 14 + ipv6HeaderLen
+
+	// Solicited and Override flags of a Neighbor Advertisement
+	ndpFlagsSolicitedOverride = 0x60
+)
+
+var errNotSolicitation = errors.New("not a neighbor solicitation")
+
+// NeighborSolicitation holds the fields of a Neighbor Solicitation needed
+// to answer it
+type NeighborSolicitation struct {
+	SourceMAC net.HardwareAddr
+	SourceIP  net.IP
+	TargetIP  net.IP
+}
+
+// ListenAndServeNDP starts the IPv6 Neighbor Discovery proxy on a single
+// interface, answering Neighbor Solicitations for the remote IPv6 entries
+// with the MAC address of the interface. Like ListenAndServe it only
+// returns when the interface can't be opened or read from anymore or the
+// proxy stopped.
+func (p *Proxy) ListenAndServeNDP(ifaceName string) error {
+	listenIface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return err
+	}
+
+	conn, err := raw.ListenPacket(listenIface, raw.Protocol(ethernet.EtherTypeIPv6))
+	if err != nil {
+		return err
+	}
+	if err := p.listening(conn); err != nil {
+		return err
+	}
+	defer p.closed(conn)
+	defer conn.Close()
+
+	filter, err := bpf.Assemble(solicitationFilter())
+	if err == nil {
+		err = conn.SetBPF(filter)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Listening for NDP solicitations on %s", ifaceName)
+	b := make([]byte, listenIface.MTU+14)
+	for {
+		if err := p.nextRead(conn); err != nil {
+			return err
+		}
+		n, _, err := conn.ReadFrom(b)
+		if timedOut(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		ns, err := ParseNeighborSolicitation(b[:n])
+		if err != nil {
+			continue
+		}
+
+		// Solicitations from the unspecified address are duplicate
+		// address detection probes, answering them would make the
+		// requester give up its address
+		if ns.SourceIP.IsUnspecified() {
+			continue
+		}
+
+		targetIP := ns.TargetIP.String()
+		log.Debugf("NDP solicitation for %s", targetIP)
+		data := map[string]string{
+			"interface":    ifaceName,
+			"target":       targetIP,
+			"requesterIp":  ns.SourceIP.String(),
+			"requesterMac": ns.SourceMAC.String(),
+		}
+		if !p.db.IsRemote(targetIP) {
+			events.Publish(events.NDPIgnored, data)
+			continue
+		}
+		if p.BlockConflicts && p.conflicts.has(targetIP) {
+			data["reason"] = "conflict"
+			events.Publish(events.NDPIgnored, data)
+			continue
+		}
+
+		log.Debugf("Sending neighbor advertisement for %s", targetIP)
+		reply, err := NeighborAdvertisement(ns, listenIface.HardwareAddr)
+		if err == nil {
+			_, err = conn.WriteTo(reply, &raw.Addr{HardwareAddr: ns.SourceMAC})
+		}
+		if err != nil {
+			log.Errorf("ndp: couldn't reply to %s for %s on %s: %v", data["requesterIp"], targetIP, ifaceName, err)
+			continue
+		}
+		events.Publish(events.NDPReply, data)
+	}
+}
+
+// solicitationFilter matches the ICMPv6 Neighbor Solicitations, so the
+// rest of the IPv6 traffic of the interface never wakes the proxy up
+func solicitationFilter() []bpf.Instruction {
+	return []bpf.Instruction{
+		bpf.LoadAbsolute{Off: ipv6NextHeaderOffset, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: protocolICMPv6<<8 | ndpHopLimit, SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+		bpf.LoadAbsolute{Off: icmpTypeOffset, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: icmpNeighborSolicitation, SkipTrue: 1},
+		bpf.RetConstant{Val: 0},
+		bpf.RetConstant{Val: acceptLen},
+	}
+}
+
+// ParseNeighborSolicitation extracts the Neighbor Solicitation carried by
+// the ethernet frame
+func ParseNeighborSolicitation(frame []byte) (*NeighborSolicitation, error) {
+	f := &ethernet.Frame{}
+	if err := f.UnmarshalBinary(frame); err != nil {
+		return nil, err
+	}
+
+	p := f.Payload
+	if f.EtherType != ethernet.EtherTypeIPv6 || len(p) < ipv6HeaderLen+24 {
+		return nil, errNotSolicitation
+	}
+	if p[6] != protocolICMPv6 || p[7] != ndpHopLimit {
+		return nil, errNotSolicitation
+	}
+
+	icmp := p[ipv6HeaderLen:]
+	if icmp[0] != icmpNeighborSolicitation || icmp[1] != 0 {
+		return nil, errNotSolicitation
+	}
+
+	return &NeighborSolicitation{
+		SourceMAC: f.Source,
+		SourceIP:  net.IP(p[8:24]),
+		TargetIP:  net.IP(icmp[8:24]),
+	}, nil
+}
+
+// NeighborAdvertisement builds the ethernet frame answering the
+// solicitation with the given MAC address
+func NeighborAdvertisement(ns *NeighborSolicitation, mac net.HardwareAddr) ([]byte, error) {
+	icmp := make([]byte, 32)
+	icmp[0] = icmpNeighborAdvertisement
+	icmp[4] = ndpFlagsSolicitedOverride
+	copy(icmp[8:24], ns.TargetIP.To16())
+	icmp[24] = ndpOptionTargetLinkAddr
+	icmp[25] = 1
+	copy(icmp[26:32], mac)
+
+	src := ns.TargetIP.To16()
+	dst := ns.SourceIP.To16()
+	binary.BigEndian.PutUint16(icmp[2:4], icmpv6Checksum(src, dst, icmp))
+
+	p := make([]byte, ipv6HeaderLen+len(icmp))
+	p[0] = 6 << 4
+	binary.BigEndian.PutUint16(p[4:6], uint16(len(icmp)))
+	p[6] = protocolICMPv6
+	p[7] = ndpHopLimit
+	copy(p[8:24], src)
+	copy(p[24:40], dst)
+	copy(p[ipv6HeaderLen:], icmp)
+
+	f := &ethernet.Frame{
+		Destination: ns.SourceMAC,
+		Source:      mac,
+		EtherType:   ethernet.EtherTypeIPv6,
+		Payload:     p,
+	}
+	return f.MarshalBinary()
+}
+
+func icmpv6Checksum(src, dst net.IP, icmp []byte) uint16 {
+	pseudo := make([]byte, 40, 40+len(icmp)+1)
+	copy(pseudo[0:16], src)
+	copy(pseudo[16:32], dst)
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(icmp)))
+	pseudo[39] = protocolICMPv6
+	b := append(pseudo, icmp...)
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+
+	var sum uint32
+	for i := 0; i < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,159 @@
+package arp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/mdlayher/ethernet"
+	"golang.org/x/net/bpf"
+)
+
+var (
+	requesterMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	proxyMAC     = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	requesterIP  = net.ParseIP("fd00::1")
+	targetIP     = net.ParseIP("fd00::2")
+)
+
+// solicitation builds the ethernet frame of a Neighbor Solicitation for
+// target, as sent by a container
+func solicitation(t *testing.T, src, target net.IP) []byte {
+	icmp := make([]byte, 32)
+	icmp[0] = icmpNeighborSolicitation
+	copy(icmp[8:24], target.To16())
+	icmp[24] = 1
+	icmp[25] = 1
+	copy(icmp[26:32], requesterMAC)
+
+	dst := net.ParseIP("ff02::1:ff00:2")
+	binary.BigEndian.PutUint16(icmp[2:4], icmpv6Checksum(src.To16(), dst.To16(), icmp))
+
+	p := make([]byte, ipv6HeaderLen+len(icmp))
+	p[0] = 6 << 4
+	binary.BigEndian.PutUint16(p[4:6], uint16(len(icmp)))
+	p[6] = protocolICMPv6
+	p[7] = ndpHopLimit
+	copy(p[8:24], src.To16())
+	copy(p[24:40], dst.To16())
+	copy(p[ipv6HeaderLen:], icmp)
+
+	f := &ethernet.Frame{
+		Destination: net.HardwareAddr{0x33, 0x33, 0xff, 0x00, 0x00, 0x02},
+		Source:      requesterMAC,
+		EtherType:   ethernet.EtherTypeIPv6,
+		Payload:     p,
+	}
+	frame, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestParseNeighborSolicitation(t *testing.T) {
+	ns, err := ParseNeighborSolicitation(solicitation(t, requesterIP, targetIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.SourceMAC.String() != requesterMAC.String() || !ns.SourceIP.Equal(requesterIP) || !ns.TargetIP.Equal(targetIP) {
+		t.Errorf("unexpected solicitation: %+v", ns)
+	}
+
+	frame := solicitation(t, requesterIP, targetIP)
+	frame[14+ipv6HeaderLen] = icmpNeighborAdvertisement
+	if _, err := ParseNeighborSolicitation(frame); err != errNotSolicitation {
+		t.Errorf("expected an advertisement to be rejected, got %v", err)
+	}
+
+	frame = solicitation(t, requesterIP, targetIP)
+	frame[14+7] = 64
+	if _, err := ParseNeighborSolicitation(frame); err != errNotSolicitation {
+		t.Errorf("expected a forwarded solicitation to be rejected, got %v", err)
+	}
+}
+
+func TestNeighborAdvertisement(t *testing.T) {
+	ns, err := ParseNeighborSolicitation(solicitation(t, requesterIP, targetIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := NeighborAdvertisement(ns, proxyMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &ethernet.Frame{}
+	if err := f.UnmarshalBinary(reply); err != nil {
+		t.Fatal(err)
+	}
+	if f.Destination.String() != requesterMAC.String() || f.Source.String() != proxyMAC.String() || f.EtherType != ethernet.EtherTypeIPv6 {
+		t.Errorf("unexpected ethernet header: %s -> %s, %v", f.Source, f.Destination, f.EtherType)
+	}
+
+	p := f.Payload
+	if p[6] != protocolICMPv6 || p[7] != ndpHopLimit {
+		t.Errorf("unexpected next header %d or hop limit %d", p[6], p[7])
+	}
+	if !net.IP(p[8:24]).Equal(targetIP) || !net.IP(p[24:40]).Equal(requesterIP) {
+		t.Errorf("unexpected addresses: %s -> %s", net.IP(p[8:24]), net.IP(p[24:40]))
+	}
+
+	icmp := p[ipv6HeaderLen:]
+	if int(binary.BigEndian.Uint16(p[4:6])) != len(icmp) {
+		t.Errorf("unexpected payload length %d", binary.BigEndian.Uint16(p[4:6]))
+	}
+	if icmp[0] != icmpNeighborAdvertisement || icmp[4] != ndpFlagsSolicitedOverride {
+		t.Errorf("unexpected type %d or flags %#x", icmp[0], icmp[4])
+	}
+	if !net.IP(icmp[8:24]).Equal(targetIP) {
+		t.Errorf("unexpected target %s", net.IP(icmp[8:24]))
+	}
+	if icmp[24] != ndpOptionTargetLinkAddr || !bytes.Equal(icmp[26:32], proxyMAC) {
+		t.Errorf("unexpected target link address option %v", icmp[24:32])
+	}
+
+	// The checksum over a packet including its checksum is 0
+	if sum := icmpv6Checksum(net.IP(p[8:24]), net.IP(p[24:40]), icmp); sum != 0 {
+		t.Errorf("invalid checksum %#04x, sums to %#04x", binary.BigEndian.Uint16(icmp[2:4]), sum)
+	}
+}
+
+func TestICMPv6Checksum(t *testing.T) {
+	// Echo request from fe80::1 to fe80::2 with identifier 1 and sequence 1
+	src := net.ParseIP("fe80::1")
+	dst := net.ParseIP("fe80::2")
+	icmp := []byte{128, 0, 0, 0, 0, 1, 0, 1}
+	if sum := icmpv6Checksum(src, dst, icmp); sum != 0x82b6 {
+		t.Errorf("expected checksum 0x82b6, got %#04x", sum)
+	}
+
+	// Odd lengths are padded with a zero byte
+	if icmpv6Checksum(src, dst, append(icmp, 0x61)) == icmpv6Checksum(src, dst, icmp) {
+		t.Error("expected the trailing byte to change the checksum")
+	}
+}
+
+func TestSolicitationFilter(t *testing.T) {
+	vm, err := bpf.NewVM(solicitationFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := vm.Run(solicitation(t, requesterIP, targetIP)); err != nil || n == 0 {
+		t.Errorf("expected the solicitation to pass, got %d, %v", n, err)
+	}
+
+	ns, _ := ParseNeighborSolicitation(solicitation(t, requesterIP, targetIP))
+	reply, _ := NeighborAdvertisement(ns, proxyMAC)
+	if n, err := vm.Run(reply); err != nil || n != 0 {
+		t.Errorf("expected the advertisement to be dropped, got %d, %v", n, err)
+	}
+
+	frame := solicitation(t, requesterIP, targetIP)
+	frame[14+6] = 17
+	if n, err := vm.Run(frame); err != nil || n != 0 {
+		t.Errorf("expected UDP to be dropped, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,222 @@
+package arp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+)
+
+const (
+	// DefaultInterface is the interface the proxy listens on when none is configured
+	DefaultInterface = "eth0"
+
+	// DefaultBackoff is the default delay before restarting a failed listener
+	DefaultBackoff = time.Second
+
+	// DefaultMaxBackoff is the default upper bound of the delay between restarts
+	DefaultMaxBackoff = 30 * time.Second
+
+	// readTimeout bounds every read of the listeners, so they notice the
+	// proxy stopping. Closing a raw socket doesn't interrupt a blocked
+	// read.
+	readTimeout = 500 * time.Millisecond
+
+	// DefaultResync is the default interval of the checks against the
+	// store catching up with the entry events dropped by the broker
+	DefaultResync = 30 * time.Second
+)
+
+// Proxy answers ARP requests, and optionally IPv6 Neighbor Solicitations,
+// for remote containers on several interfaces. Every interface gets its own
+// listeners which are restarted with an exponential backoff whenever they
+// fail, so a flapping interface doesn't affect the others or the agent.
+type Proxy struct {
+	Interfaces []string
+	Mode       string
+	NDP        bool
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Announce sends gratuitous ARPs on topology changes, AnnounceRate
+	// per second with bursts of AnnounceBurst, both at least 1
+	Announce      bool
+	AnnounceRate  int
+	AnnounceBurst int
+
+	// Resync is how often the entries are checked against the store
+	// besides on the entry events, which the broker drops when the proxy
+	// falls behind
+	Resync time.Duration
+
+	// Network is the additional network of the store, empty for the one
+	// of the agent. Only the entry and conflict events of that network
+	// are handled.
+	Network string
+
+	// BlockConflicts stops answering for remote IPs involved in a conflict
+	BlockConflicts bool
+
+	db        store.Store
+	conflicts *conflicts
+	stats     *stats
+
+	stop          chan struct{}
+	stopOnce      sync.Once
+	supervisors   sync.WaitGroup
+	listenersLock sync.Mutex
+	listeners     map[io.Closer]bool
+}
+
+// ownEvent reports whether the event is about the network of the proxy
+func (p *Proxy) ownEvent(event events.Event) bool {
+	return event.Data[events.NetworkKey] == p.Network
+}
+
+// errStopped is returned by the listeners opened after the proxy stopped
+var errStopped = errors.New("proxy stopped")
+
+// NewProxy creates a Proxy listening on the given interfaces
+func NewProxy(db store.Store, interfaces []string) *Proxy {
+	if len(interfaces) == 0 {
+		interfaces = []string{DefaultInterface}
+	}
+	return &Proxy{
+		Interfaces:    interfaces,
+		Mode:          ModeSocket,
+		Backoff:       DefaultBackoff,
+		MaxBackoff:    DefaultMaxBackoff,
+		Announce:      true,
+		AnnounceRate:  DefaultAnnounceRate,
+		AnnounceBurst: DefaultAnnounceBurst,
+		Resync:        DefaultResync,
+		db:            db,
+		conflicts:     newConflicts(),
+		stats:         newStats(DefaultDecisionLogSize),
+		stop:          make(chan struct{}),
+		listeners:     map[io.Closer]bool{},
+	}
+}
+
+// Start launches the supervised listeners for every interface
+func (p *Proxy) Start() {
+	serve := p.ListenAndServe
+	if p.Mode == ModeBPF {
+		serve = p.ListenAndServeFiltered
+	}
+
+	for _, ifaceName := range p.Interfaces {
+		p.supervisors.Add(1)
+		go p.supervise("arp", ifaceName, serve)
+		if p.NDP {
+			p.supervisors.Add(1)
+			go p.supervise("ndp", ifaceName, p.ListenAndServeNDP)
+		}
+	}
+	if p.Announce {
+		go p.announce()
+	}
+	go p.trackConflicts()
+}
+
+// Stop closes the listeners, waiting for them to return, and stops the
+// announcements. The proxy can't be started again.
+func (p *Proxy) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+
+	p.listenersLock.Lock()
+	for l := range p.listeners {
+		l.Close()
+		delete(p.listeners, l)
+	}
+	p.listenersLock.Unlock()
+
+	p.supervisors.Wait()
+}
+
+// deadlineReader is a listener whose reads can time out
+type deadlineReader interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// nextRead gives the next read of the listener a fresh deadline, the
+// reads started past their deadline never return on raw sockets. It
+// returns errStopped once the proxy stopped.
+func (p *Proxy) nextRead(l deadlineReader) error {
+	select {
+	case <-p.stop:
+		return errStopped
+	default:
+	}
+	return l.SetReadDeadline(time.Now().Add(readTimeout))
+}
+
+// timedOut tells whether the read failed on its deadline, the listener
+// then reads again
+func timedOut(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// listening tracks the listener so Stop closes it, it's closed right
+// away when the proxy already stopped
+func (p *Proxy) listening(l io.Closer) error {
+	p.listenersLock.Lock()
+	defer p.listenersLock.Unlock()
+
+	select {
+	case <-p.stop:
+		l.Close()
+		return errStopped
+	default:
+	}
+	p.listeners[l] = true
+	return nil
+}
+
+func (p *Proxy) closed(l io.Closer) {
+	p.listenersLock.Lock()
+	defer p.listenersLock.Unlock()
+	delete(p.listeners, l)
+}
+
+func (p *Proxy) supervise(kind, ifaceName string, serve func(string) error) {
+	defer p.supervisors.Done()
+
+	backoff := p.Backoff
+	for {
+		started := time.Now()
+		err := serve(ifaceName)
+		select {
+		case <-p.stop:
+			log.Infof("%s: stopped listening on %s", kind, ifaceName)
+			return
+		default:
+		}
+		p.stats.listenerError(ifaceName)
+
+		// A listener which ran for a while failed on a new problem,
+		// don't punish it for the earlier ones
+		if time.Since(started) > p.MaxBackoff {
+			backoff = p.Backoff
+		}
+
+		log.Errorf("%s: listener on %s failed, restarting in %v: %v", kind, ifaceName, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-p.stop:
+			return
+		}
+		backoff *= 2
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package arp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopWaitsForListeners(t *testing.T) {
+	p := NewProxy(nil, nil)
+
+	returned := make(chan struct{})
+	p.supervisors.Add(1)
+	go p.supervise("arp", "eth0", func(string) error {
+		// A listener notices the proxy stopping at its next read
+		<-p.stop
+		time.Sleep(readTimeout)
+		close(returned)
+		return errStopped
+	})
+
+	p.Stop()
+	select {
+	case <-returned:
+	default:
+		t.Fatal("Stop returned before the listener")
+	}
+
+	if err := p.nextRead(nil); err != errStopped {
+		t.Errorf("expected no more reads once stopped, got %v", err)
+	}
+}
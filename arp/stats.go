@@ -0,0 +1,165 @@
+package arp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rancher/ipsec/events"
+)
+
+// DefaultDecisionLogSize is the default number of decisions remembered
+const DefaultDecisionLogSize = 256
+
+// Decisions taken by the proxy for an ARP request
+const (
+	DecisionReply        = "reply"
+	DecisionLocal        = "local"
+	DecisionUnknown      = "unknown"
+	DecisionNotBroadcast = "not-broadcast"
+	DecisionConflict     = "conflict"
+	DecisionError        = "error"
+)
+
+// Decision is what the proxy did with an ARP request
+type Decision struct {
+	Time         time.Time `json:"time"`
+	Interface    string    `json:"interface"`
+	RequesterIP  string    `json:"requesterIp"`
+	RequesterMAC string    `json:"requesterMac"`
+	Target       string    `json:"target"`
+	Decision     string    `json:"decision"`
+}
+
+// Stats holds the counters of an interface. On the interfaces listened on
+// in the bpf mode, Filtered is set and the requests for local and unknown
+// targets are dropped by the kernel filter before the proxy sees them, so
+// they aren't counted in Requests, IgnoredLocal or IgnoredUnknown. The
+// kernel keeps no count of the packets a filter rejects.
+type Stats struct {
+	Filtered            bool   `json:"filtered"`
+	Requests            uint64 `json:"requests"`
+	Replies             uint64 `json:"replies"`
+	IgnoredLocal        uint64 `json:"ignoredLocal"`
+	IgnoredUnknown      uint64 `json:"ignoredUnknown"`
+	IgnoredNotBroadcast uint64 `json:"ignoredNotBroadcast"`
+	IgnoredConflict     uint64 `json:"ignoredConflict"`
+	Errors              uint64 `json:"errors"`
+}
+
+// stats counts the decisions per interface and remembers the most recent
+// ones in a ring buffer
+type stats struct {
+	sync.Mutex
+
+	byInterface map[string]*Stats
+	decisions   []Decision
+	next        int
+	full        bool
+}
+
+func newStats(size int) *stats {
+	if size < 1 {
+		size = 1
+	}
+	return &stats{
+		byInterface: map[string]*Stats{},
+		decisions:   make([]Decision, size),
+	}
+}
+
+func (s *stats) interfaceStats(ifaceName string) *Stats {
+	st, ok := s.byInterface[ifaceName]
+	if !ok {
+		st = &Stats{}
+		s.byInterface[ifaceName] = st
+	}
+	return st
+}
+
+// record counts and remembers the decision, and publishes it as an event
+func (s *stats) record(d Decision) {
+	d.Time = time.Now().UTC()
+
+	s.Lock()
+	st := s.interfaceStats(d.Interface)
+	st.Requests++
+	switch d.Decision {
+	case DecisionReply:
+		st.Replies++
+	case DecisionLocal:
+		st.IgnoredLocal++
+	case DecisionUnknown:
+		st.IgnoredUnknown++
+	case DecisionNotBroadcast:
+		st.IgnoredNotBroadcast++
+	case DecisionConflict:
+		st.IgnoredConflict++
+	case DecisionError:
+		st.Errors++
+	}
+
+	s.decisions[s.next] = d
+	s.next = (s.next + 1) % len(s.decisions)
+	if s.next == 0 {
+		s.full = true
+	}
+	s.Unlock()
+
+	data := map[string]string{
+		"interface":    d.Interface,
+		"target":       d.Target,
+		"requesterIp":  d.RequesterIP,
+		"requesterMac": d.RequesterMAC,
+	}
+	if d.Decision == DecisionReply {
+		events.Publish(events.ARPReply, data)
+	} else if d.Decision != DecisionError {
+		data["reason"] = d.Decision
+		events.Publish(events.ARPIgnored, data)
+	}
+}
+
+// filtered marks the interface as listened on with a kernel filter
+func (s *stats) filtered(ifaceName string) {
+	s.Lock()
+	defer s.Unlock()
+	s.interfaceStats(ifaceName).Filtered = true
+}
+
+// listenerError counts a failure of the listener of the interface
+func (s *stats) listenerError(ifaceName string) {
+	s.Lock()
+	defer s.Unlock()
+	s.interfaceStats(ifaceName).Errors++
+}
+
+func (s *stats) counters() map[string]Stats {
+	s.Lock()
+	defer s.Unlock()
+
+	result := map[string]Stats{}
+	for ifaceName, st := range s.byInterface {
+		result[ifaceName] = *st
+	}
+	return result
+}
+
+func (s *stats) list() []Decision {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.full {
+		return append([]Decision{}, s.decisions[:s.next]...)
+	}
+	return append(append([]Decision{}, s.decisions[s.next:]...), s.decisions[:s.next]...)
+}
+
+// Stats returns the counters of every interface the proxy listened on
+func (p *Proxy) Stats() map[string]Stats {
+	return p.stats.counters()
+}
+
+// Decisions returns the most recent decisions, oldest first
+func (p *Proxy) Decisions() []Decision {
+	return p.stats.list()
+}
@@ -1,6 +1,104 @@
 package backend
 
+import (
+	"errors"
+	"time"
+)
+
+// Trigger identifies what caused a reconcile run
+type Trigger string
+
+const (
+	// TriggerStartup is used for the initial reconcile when the agent starts
+	TriggerStartup Trigger = "startup"
+
+	// TriggerMetadata is used when a metadata change caused the reconcile
+	TriggerMetadata Trigger = "metadata"
+
+	// TriggerAPI is used when the reconcile was requested through the API
+	TriggerAPI Trigger = "api"
+
+	// TriggerMonitor is used when the SA monitor requested the reconcile
+	TriggerMonitor Trigger = "monitor"
+
+	// TriggerRotate is used when the keys of the SAs are due for rotation
+	TriggerRotate Trigger = "rotate"
+)
+
+const (
+	// RunQueued is the state of a run waiting to be processed
+	RunQueued = "queued"
+
+	// RunRunning is the state of a run in progress
+	RunRunning = "running"
+
+	// RunSucceeded is the state of a run which completed without errors
+	RunSucceeded = "succeeded"
+
+	// RunFailed is the state of a run which completed with an error
+	RunFailed = "failed"
+)
+
+// PeerResult holds the outcome of configuring a single peer host
+type PeerResult struct {
+	Host  string `json:"host"`
+	Error string `json:"error,omitempty"`
+}
+
+// Run holds the information about a single reconcile of the backend
+type Run struct {
+	ID              string       `json:"id"`
+	Trigger         Trigger      `json:"trigger"`
+	MetadataVersion string       `json:"metadataVersion,omitempty"`
+	State           string       `json:"state"`
+	Created         time.Time    `json:"created"`
+	Started         time.Time    `json:"started"`
+	Duration        string       `json:"duration,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	Peers           []PeerResult `json:"peers,omitempty"`
+	PoliciesAdded   []string     `json:"policiesAdded,omitempty"`
+	PoliciesRemoved []string     `json:"policiesRemoved,omitempty"`
+}
+
+// ErrNotSupported is returned by the backends for the operations they
+// don't implement
+var ErrNotSupported = errors.New("not supported by the backend")
+
+// Backend defines the interface for the data plane implementations
 type Backend interface {
 	Start(launch bool, logFile string)
+
+	// Stop stops reconciling, waiting for the run in progress. The
+	// state set up in the kernel is left as is.
+	Stop() error
+
+	// Cleanup removes the policies, SAs and connections set up by the
+	// backend. It's meant for uninstalling, after Stop.
+	Cleanup() error
+
+	// Handover leaves the policies and SAs in place for the next agent,
+	// saving what it needs to take them over in the state directory. It's
+	// meant for upgrades, after Stop, on the request of the next agent.
+	Handover() error
+
 	Reload() error
+	Submit(trigger Trigger, version string) string
+	Runs() []Run
+	EffectiveConfig() interface{}
+
+	Status() (Status, error)
+	Peers() ([]Peer, error)
+	SAs() ([]SA, error)
+	Policies() ([]Policy, error)
+
+	// InitiatePeer and TerminatePeer control the tunnel to a single
+	// peer, ErrNotSupported is returned by the backends which can't. The
+	// peer is given by its PeerID.
+	InitiatePeer(id string) error
+	TerminatePeer(id string) error
+
+	// WatchPeers calls updown with the PeerID of the peers whose tunnel
+	// goes up or down, as it happens, until stop is closed. It returns
+	// right away, ErrNotSupported from the backends which can't tell.
+	WatchPeers(stop <-chan struct{}, updown func(id string, up bool)) error
 }
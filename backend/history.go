@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// History keeps track of the most recent reconcile runs
+type History struct {
+	sync.Mutex
+
+	size   int
+	lastID int
+	runs   []Run
+}
+
+// NewHistory creates a History which remembers up to size runs
+func NewHistory(size int) *History {
+	return &History{
+		size: size,
+	}
+}
+
+// Queue records a new queued run and returns its ID. If a run is
+// already waiting to be processed its ID is returned instead, as that
+// run will pick up the latest state anyway. The returned bool is true
+// only when a new run was queued.
+func (h *History) Queue(trigger Trigger, version string) (string, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, run := range h.runs {
+		if run.State == RunQueued {
+			return run.ID, false
+		}
+	}
+
+	run := h.add(trigger, version)
+	return run.ID, true
+}
+
+// Begin records a new run which is processed right away
+func (h *History) Begin(trigger Trigger, version string) Run {
+	h.Lock()
+	defer h.Unlock()
+
+	run := h.add(trigger, version)
+	run.State = RunRunning
+	run.Started = run.Created
+
+	return *run
+}
+
+// Start marks the queued run with the given ID as running
+func (h *History) Start(id string) (Run, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	for i := range h.runs {
+		if h.runs[i].ID == id {
+			h.runs[i].State = RunRunning
+			h.runs[i].Started = time.Now()
+			return h.runs[i], true
+		}
+	}
+
+	return Run{}, false
+}
+
+// Finish stores the results of the run
+func (h *History) Finish(run Run, err error) {
+	h.Lock()
+	defer h.Unlock()
+
+	run.Duration = time.Since(run.Started).String()
+	if err != nil {
+		run.State = RunFailed
+		run.Error = err.Error()
+	} else {
+		run.State = RunSucceeded
+	}
+
+	h.update(run)
+}
+
+// List returns the remembered runs, oldest first
+func (h *History) List() []Run {
+	h.Lock()
+	defer h.Unlock()
+
+	runs := make([]Run, len(h.runs))
+	copy(runs, h.runs)
+	return runs
+}
+
+func (h *History) add(trigger Trigger, version string) *Run {
+	h.lastID++
+	h.runs = append(h.runs, Run{
+		ID:              strconv.Itoa(h.lastID),
+		Trigger:         trigger,
+		MetadataVersion: version,
+		State:           RunQueued,
+		Created:         time.Now(),
+	})
+	if len(h.runs) > h.size {
+		h.runs = h.runs[len(h.runs)-h.size:]
+	}
+
+	return &h.runs[len(h.runs)-1]
+}
+
+func (h *History) update(run Run) {
+	for i := range h.runs {
+		if h.runs[i].ID == run.ID {
+			h.runs[i] = run
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestHistoryQueue(t *testing.T) {
+	h := NewHistory(20)
+
+	id, queued := h.Queue(TriggerMetadata, "1")
+	if !queued {
+		t.Fatal("expected the first request to queue a run")
+	}
+
+	// The queued run picks up the latest state, later requests join it
+	for _, trigger := range []Trigger{TriggerAPI, TriggerMonitor, TriggerMetadata} {
+		if again, queued := h.Queue(trigger, "2"); queued || again != id {
+			t.Errorf("%s: expected to join run %s, got %s, queued: %v", trigger, id, again, queued)
+		}
+	}
+
+	// Once started, the next request queues another run
+	run, ok := h.Start(id)
+	if !ok || run.State != RunRunning {
+		t.Fatalf("expected run %s to start, got %+v", id, run)
+	}
+	next, queued := h.Queue(TriggerAPI, "")
+	if !queued || next == id {
+		t.Errorf("expected a new run, got %s, queued: %v", next, queued)
+	}
+
+	h.Finish(run, errors.New("failed"))
+	runs := h.List()
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %+v", runs)
+	}
+	if runs[0].State != RunFailed || runs[0].Error != "failed" || runs[0].MetadataVersion != "1" {
+		t.Errorf("unexpected finished run %+v", runs[0])
+	}
+	if runs[1].State != RunQueued || runs[1].Trigger != TriggerAPI {
+		t.Errorf("unexpected queued run %+v", runs[1])
+	}
+
+	if _, ok := h.Start("unknown"); ok {
+		t.Error("expected an unknown run not to start")
+	}
+}
+
+func TestHistoryEviction(t *testing.T) {
+	tests := []struct {
+		size  int
+		runs  int
+		first int
+	}{
+		{size: 20, runs: 5, first: 1},
+		{size: 20, runs: 20, first: 1},
+		{size: 20, runs: 21, first: 2},
+		{size: 20, runs: 50, first: 31},
+		{size: 1, runs: 3, first: 3},
+	}
+
+	for _, test := range tests {
+		h := NewHistory(test.size)
+		for i := 0; i < test.runs; i++ {
+			run := h.Begin(TriggerAPI, "")
+			h.Finish(run, nil)
+		}
+
+		runs := h.List()
+		kept := test.runs
+		if kept > test.size {
+			kept = test.size
+		}
+		if len(runs) != kept {
+			t.Errorf("size %d, %d runs: expected %d kept, got %d", test.size, test.runs, kept, len(runs))
+			continue
+		}
+		// The oldest ones go first, the IDs keep counting
+		for i, run := range runs {
+			if run.ID != strconv.Itoa(test.first+i) || run.State != RunSucceeded {
+				t.Errorf("size %d, %d runs: unexpected run %d: %+v", test.size, test.runs, i, run)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package xfrm holds the handling of the xfrm policies shared by the
+// backends programming them
+package xfrm
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+	"github.com/vishvananda/netlink"
+)
+
+// Key identifies the policy among the ones of a backend
+func Key(p *netlink.XfrmPolicy) string {
+	buffer := bytes.Buffer{}
+	buffer.WriteString(p.Dir.String())
+	buffer.WriteRune('-')
+	if p.Src != nil {
+		buffer.WriteString(p.Src.String())
+	}
+	buffer.WriteRune('-')
+	if p.Dst != nil {
+		buffer.WriteString(p.Dst.String())
+	}
+	buffer.WriteRune('-')
+	if p.DstPort != 0 {
+		buffer.WriteString(strconv.Itoa(int(p.Proto)))
+		buffer.WriteRune('/')
+		buffer.WriteString(strconv.Itoa(p.DstPort))
+		buffer.WriteRune('-')
+	}
+	if p.Action == netlink.XFRM_POLICY_BLOCK {
+		buffer.WriteString("block-")
+	}
+	if p.Mark != nil {
+		buffer.WriteString(strconv.FormatUint(uint64(p.Mark.Value), 16))
+		buffer.WriteRune('-')
+	}
+	if len(p.Tmpls) > 0 {
+		buffer.WriteString(p.Tmpls[0].Src.String())
+		buffer.WriteRune('-')
+		buffer.WriteString(p.Tmpls[0].Dst.String())
+		buffer.WriteRune('-')
+		buffer.WriteString(strconv.Itoa(p.Tmpls[0].Reqid))
+	}
+
+	return buffer.String()
+}
+
+// Want keeps the policy if it's among the existing ones, removing it from
+// the ones left to delete, or adds it to the ones to add
+func Want(policy netlink.XfrmPolicy, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) {
+	key := Key(&policy)
+	if _, ok := existingPolicies[key]; ok {
+		delete(existingPolicies, key)
+	} else {
+		policiesToAdd[key] = policy
+	}
+}
+
+// AddPolicies adds the policies and returns the keys of the ones added,
+// with the last error
+func AddPolicies(policies map[string]netlink.XfrmPolicy) ([]string, error) {
+	var lastErr error
+	added := []string{}
+	for key, policy := range policies {
+		if err := netlink.XfrmPolicyAdd(&policy); err != nil {
+			log.Errorf("Failed to add policy: %+v, %v", policy, err)
+			lastErr = err
+		} else {
+			log.Infof("Added policy: %+v", policy)
+			added = append(added, key)
+			events.Publish(events.PolicyAdded, eventData(key, &policy))
+		}
+	}
+	return added, lastErr
+}
+
+// DeletePolicies deletes the policies and returns the keys of the ones
+// deleted, with the last error
+func DeletePolicies(policies map[string]netlink.XfrmPolicy) ([]string, error) {
+	var lastErr error
+	deleted := []string{}
+	for key, policy := range policies {
+		if err := netlink.XfrmPolicyDel(&policy); err != nil {
+			log.Errorf("Failed to delete policy: %+v, %v", policy, err)
+			lastErr = err
+		} else {
+			log.Infof("Deleted policy: %+v", policy)
+			deleted = append(deleted, key)
+			events.Publish(events.PolicyDeleted, eventData(key, &policy))
+		}
+	}
+	return deleted, lastErr
+}
+
+func eventData(key string, p *netlink.XfrmPolicy) map[string]string {
+	data := map[string]string{
+		"key":    key,
+		"dir":    p.Dir.String(),
+		"action": p.Action.String(),
+	}
+	if p.Src != nil {
+		data["src"] = p.Src.String()
+	}
+	if p.Dst != nil {
+		data["dst"] = p.Dst.String()
+	}
+	return data
+}
+
+// ToPolicy returns the policy as reported by the backends
+func ToPolicy(p netlink.XfrmPolicy) backend.Policy {
+	policy := backend.Policy{
+		Dir:      p.Dir.String(),
+		Priority: p.Priority,
+	}
+	if p.Src != nil {
+		policy.Src = p.Src.String()
+	}
+	if p.Dst != nil {
+		policy.Dst = p.Dst.String()
+	}
+	if len(p.Tmpls) > 0 {
+		policy.TmplSrc = p.Tmpls[0].Src.String()
+		policy.TmplDst = p.Tmpls[0].Dst.String()
+		policy.ReqID = p.Tmpls[0].Reqid
+	}
+	return policy
+}
+
+// Selectors returns the local subnet and the host network of the IP of
+// the entry, or nils when the entry can't be matched locally
+func Selectors(db store.Store, entry store.Entry) (*net.IPNet, *net.IPNet, error) {
+	ip, _, err := net.ParseCIDR(entry.IPAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// IPv6 entries are matched against the IPv6 subnet of the local
+	// network, the tunnel itself runs between the same addresses
+	localSubnetCIDR, hostBits := db.LocalSubnet(), 32
+	if ip.To4() == nil {
+		localSubnetCIDR, hostBits = db.LocalSubnetV6(), 128
+		if localSubnetCIDR == "" {
+			return nil, nil, nil
+		}
+	}
+
+	_, localSubnet, err := net.ParseCIDR(localSubnetCIDR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, ipDirectNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", ip, hostBits))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return localSubnet, ipDirectNet, nil
+}
@@ -0,0 +1,152 @@
+package xfrm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/rancher/ipsec/store"
+	"github.com/vishvananda/netlink"
+)
+
+func mustCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestKey(t *testing.T) {
+	tunnel := netlink.XfrmPolicy{
+		Src: mustCIDR(t, "10.42.0.0/16"),
+		Dst: mustCIDR(t, "10.42.1.2/32"),
+		Dir: netlink.XFRM_DIR_OUT,
+		Tmpls: []netlink.XfrmPolicyTmpl{
+			{Src: net.ParseIP("192.168.0.1"), Dst: net.ParseIP("192.168.0.2"), Reqid: 1234},
+		},
+	}
+	block := netlink.XfrmPolicy{
+		Src:    mustCIDR(t, "10.42.0.0/16"),
+		Dst:    mustCIDR(t, "10.42.1.2/32"),
+		Dir:    netlink.XFRM_DIR_OUT,
+		Action: netlink.XFRM_POLICY_BLOCK,
+	}
+	vxlan := netlink.XfrmPolicy{
+		Src:     mustCIDR(t, "0.0.0.0/0"),
+		Dst:     mustCIDR(t, "0.0.0.0/0"),
+		Dir:     netlink.XFRM_DIR_IN,
+		Proto:   netlink.Proto(syscall.IPPROTO_UDP),
+		DstPort: 4789,
+		Action:  netlink.XFRM_POLICY_BLOCK,
+	}
+	marked := tunnel
+	marked.Mark = &netlink.XfrmMark{Value: 0x07000001, Mask: 0xffffffff}
+
+	tests := []struct {
+		policy netlink.XfrmPolicy
+		key    string
+	}{
+		{policy: tunnel, key: "dir out-10.42.0.0/16-10.42.1.2/32-192.168.0.1-192.168.0.2-1234"},
+		{policy: block, key: "dir out-10.42.0.0/16-10.42.1.2/32-block-"},
+		{policy: vxlan, key: "dir in-0.0.0.0/0-0.0.0.0/0-17/4789-block-"},
+		{policy: marked, key: "dir out-10.42.0.0/16-10.42.1.2/32-7000001-192.168.0.1-192.168.0.2-1234"},
+	}
+
+	for _, test := range tests {
+		if key := Key(&test.policy); key != test.key {
+			t.Errorf("expected %s, got %s", test.key, key)
+		}
+	}
+}
+
+func TestWant(t *testing.T) {
+	kept := netlink.XfrmPolicy{Dst: mustCIDR(t, "10.42.1.2/32"), Dir: netlink.XFRM_DIR_OUT}
+	stale := netlink.XfrmPolicy{Dst: mustCIDR(t, "10.42.1.3/32"), Dir: netlink.XFRM_DIR_OUT}
+	added := netlink.XfrmPolicy{Dst: mustCIDR(t, "10.42.1.4/32"), Dir: netlink.XFRM_DIR_OUT}
+
+	existing := map[string]netlink.XfrmPolicy{
+		Key(&kept):  kept,
+		Key(&stale): stale,
+	}
+	toAdd := map[string]netlink.XfrmPolicy{}
+	Want(kept, existing, toAdd)
+	Want(added, existing, toAdd)
+
+	if _, ok := existing[Key(&stale)]; !ok || len(existing) != 1 {
+		t.Errorf("expected only the stale policy left to delete, got %v", existing)
+	}
+	if _, ok := toAdd[Key(&added)]; !ok || len(toAdd) != 1 {
+		t.Errorf("expected only the new policy to add, got %v", toAdd)
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	tests := []struct {
+		localSubnetV6 string
+		ip            string
+		local         string
+		remote        string
+		err           bool
+	}{
+		{ip: "10.42.1.2/16", local: "10.42.0.0/16", remote: "10.42.1.2/32"},
+		{localSubnetV6: "fd00::/64", ip: "fd00::2/64", local: "fd00::/64", remote: "fd00::2/128"},
+		{ip: "fd00::2/64"},
+		{ip: "10.42.1.2", err: true},
+	}
+
+	for _, test := range tests {
+		db := newStore(t, test.localSubnetV6)
+		local, remote, err := Selectors(db, store.Entry{IPAddress: test.ip})
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.ip)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.ip, err)
+			continue
+		}
+		if test.local == "" {
+			if local != nil || remote != nil {
+				t.Errorf("%s: expected no selectors, got %v and %v", test.ip, local, remote)
+			}
+			continue
+		}
+		if local.String() != test.local || remote.String() != test.remote {
+			t.Errorf("%s: expected %s and %s, got %v and %v", test.ip, test.local, test.remote, local, remote)
+		}
+	}
+}
+
+// newStore returns a store with the local subnet 10.42.0.0/16 and the
+// given IPv6 one
+func newStore(t *testing.T, localSubnetV6 string) store.Store {
+	dir, err := ioutil.TempDir("", "xfrm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content, err := json.Marshal(map[string]interface{}{
+		"self":          store.Entry{IPAddress: "10.42.0.1/16", HostIPAddress: "192.168.0.1", Self: true},
+		"localSubnet":   "10.42.0.0/16",
+		"localSubnetV6": localSubnetV6,
+	})
+	if err == nil {
+		err = ioutil.WriteFile(path.Join(dir, "store.json"), content, 0600)
+	}
+	db := store.NewFileStore(path.Join(dir, "store.json"))
+	if err == nil {
+		err = db.Reload()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,195 @@
+package ipsec
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/bronze1man/goStrongswanVici"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// DefaultChildSAs is the default number of CHILD_SAs to every peer
+	DefaultChildSAs = 1
+
+	// MaxChildSAs is the highest number of CHILD_SAs to every peer, each
+	// one taking a reqid after the one of the overlay
+	MaxChildSAs = 64
+)
+
+// childReqID returns the reqid of the k-th CHILD_SA to every host
+func (o *Overlay) childReqID(k int) int {
+	return o.ReqID + k
+}
+
+// childSAName returns the name of the k-th CHILD_SA to the host, the first
+// one keeps the name used when there's a single CHILD_SA
+func (o *Overlay) childSAName(host string, k int) string {
+	if k == 0 {
+		return o.childName(host)
+	}
+	return fmt.Sprintf("%s-%d", o.childName(host), k)
+}
+
+// childSAConfs returns the ChildSAs copies of the CHILD_SA config, each
+// one with its own reqid so the kernel keeps separate SAs for them. With
+// several of them, each one selects its own parts of the local subnets so
+// the responder maps every CHILD_SA to the config of the same reqid.
+func (o *Overlay) childSAConfs(host string, conf goStrongswanVici.ChildSAConf) map[string]goStrongswanVici.ChildSAConf {
+	children := map[string]goStrongswanVici.ChildSAConf{}
+	for k := 0; k < o.childSAs(); k++ {
+		conf.ReqID = strconv.Itoa(o.childReqID(k))
+		if o.childSAs() > 1 {
+			ts := []string{}
+			for _, part := range o.childSubnets(k) {
+				ts = append(ts, part.String())
+			}
+			conf.Local_ts = ts
+			conf.Remote_ts = ts
+		}
+		children[o.childSAName(host, k)] = conf
+	}
+	return children
+}
+
+func (o *Overlay) childSAs() int {
+	if o.ChildSAs < 1 {
+		return 1
+	}
+	return o.ChildSAs
+}
+
+// childBits returns the number of bits after the prefix of the subnets
+// splitting them in enough parts for every CHILD_SA
+func (o *Overlay) childBits() int {
+	bits := 0
+	for 1<<uint(bits) < o.childSAs() {
+		bits++
+	}
+	return bits
+}
+
+// childIndex returns the CHILD_SA carrying the traffic to the IP, the one
+// of the part of the local subnet it's in. Both sides split the subnets
+// the same way, so they agree on the CHILD_SA of every destination and
+// spread the flows to the same host over several CPUs.
+func (o *Overlay) childIndex(ip net.IP) int {
+	subnet := o.localSubnetOf(ip)
+	if subnet == nil {
+		return 0
+	}
+	for p, part := range splitNet(subnet, o.childBits()) {
+		if part.Contains(ip) {
+			return p % o.childSAs()
+		}
+	}
+	return 0
+}
+
+// childSubnets returns the parts of the local subnets carried by the k-th
+// CHILD_SA
+func (o *Overlay) childSubnets(k int) []*net.IPNet {
+	result := []*net.IPNet{}
+	for _, cidr := range []string{o.db.LocalSubnet(), o.db.LocalSubnetV6()} {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		for p, part := range splitNet(subnet, o.childBits()) {
+			if p%o.childSAs() == k {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+// localSubnetOf returns the local subnet the IP is in, nil if none
+func (o *Overlay) localSubnetOf(ip net.IP) *net.IPNet {
+	for _, cidr := range []string{o.db.LocalSubnet(), o.db.LocalSubnetV6()} {
+		if _, subnet, err := net.ParseCIDR(cidr); err == nil && subnet.Contains(ip) {
+			return subnet
+		}
+	}
+	return nil
+}
+
+// splitNet splits the network in 2^bits parts, or in single addresses when
+// it's too small for that
+func splitNet(n *net.IPNet, bits int) []*net.IPNet {
+	ones, size := n.Mask.Size()
+	if ones+bits > size {
+		bits = size - ones
+	}
+
+	base := n.IP.To16()
+	if size == 32 {
+		base = n.IP.To4()
+	}
+
+	parts := []*net.IPNet{}
+	for p := 0; p < 1<<uint(bits); p++ {
+		ip := make(net.IP, len(base))
+		copy(ip, base)
+		for i := 0; i < bits; i++ {
+			if p&(1<<uint(bits-1-i)) != 0 {
+				bit := ones + i
+				ip[bit/8] |= 0x80 >> uint(bit%8)
+			}
+		}
+		parts = append(parts, &net.IPNet{IP: ip, Mask: net.CIDRMask(ones+bits, size)})
+	}
+	return parts
+}
+
+// outReqID picks the CHILD_SA carrying the traffic to the remote network
+func (o *Overlay) outReqID(remoteNet *net.IPNet) int {
+	return o.childReqID(o.childIndex(remoteNet.IP))
+}
+
+// inSelector is the destination of the traffic from the peers accepted on
+// a CHILD_SA
+type inSelector struct {
+	dst   *net.IPNet
+	reqid int
+}
+
+// inSelectors splits the local network by the CHILD_SAs the peers send
+// the traffic to its parts on
+func (o *Overlay) inSelectors(localNet *net.IPNet) []inSelector {
+	if o.childSAs() == 1 {
+		return []inSelector{{dst: localNet, reqid: o.ReqID}}
+	}
+
+	selectors := []inSelector{}
+	for p, part := range splitNet(localNet, o.childBits()) {
+		selectors = append(selectors, inSelector{dst: part, reqid: o.childReqID(p % o.childSAs())})
+	}
+	return selectors
+}
+
+// ownsReqID tells whether the reqid is the one of a CHILD_SA of the
+// overlay. The whole range of MaxChildSAs reqids is owned, so the policies
+// and SAs left by a run with more CHILD_SAs are still removed.
+func (o *Overlay) ownsReqID(reqid int) bool {
+	return reqid >= o.childReqID(0) && reqid < o.childReqID(MaxChildSAs)
+}
+
+// ownsAnyReqIDPolicy tells whether the policy accepting the traffic on any
+// reqid was set up by an earlier version of the overlay: either to its
+// local subnet or, on a gateway, from one of its entries to anywhere. They
+// aren't added anymore, but are still removed.
+func (o *Overlay) ownsAnyReqIDPolicy(p *netlink.XfrmPolicy) bool {
+	if p.Dst == nil {
+		return false
+	}
+	if o.isLocalSubnet(p.Dst) {
+		return true
+	}
+	if ones, _ := p.Dst.Mask.Size(); ones != 0 || p.Src == nil {
+		return false
+	}
+	_, ok := o.db.RemoteEntriesMap()[p.Src.IP.String()]
+	return ok
+}
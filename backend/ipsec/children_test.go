@@ -0,0 +1,165 @@
+package ipsec
+
+import (
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func mustCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSplitNet(t *testing.T) {
+	tests := []struct {
+		net   string
+		bits  int
+		parts []string
+	}{
+		{net: "10.42.0.0/16", bits: 0, parts: []string{"10.42.0.0/16"}},
+		{net: "10.42.0.0/16", bits: 1, parts: []string{"10.42.0.0/17", "10.42.128.0/17"}},
+		{net: "10.42.0.0/16", bits: 2, parts: []string{"10.42.0.0/18", "10.42.64.0/18", "10.42.128.0/18", "10.42.192.0/18"}},
+		{net: "10.42.0.0/31", bits: 2, parts: []string{"10.42.0.0/32", "10.42.0.1/32"}},
+		{net: "fd00::/64", bits: 1, parts: []string{"fd00::/65", "fd00::8000:0:0:0/65"}},
+	}
+
+	for _, test := range tests {
+		parts := []string{}
+		for _, part := range splitNet(mustCIDR(t, test.net), test.bits) {
+			parts = append(parts, part.String())
+		}
+		if !reflect.DeepEqual(parts, test.parts) {
+			t.Errorf("%s/%d: expected %v, got %v", test.net, test.bits, test.parts, parts)
+		}
+	}
+}
+
+func TestChildIndex(t *testing.T) {
+	o, cleanup := newTestOverlay(t, testStore{LocalSubnet: "10.42.0.0/16", LocalSubnetV6: "fd00::/64"})
+	defer cleanup()
+
+	tests := []struct {
+		childSAs int
+		ip       string
+		index    int
+	}{
+		{childSAs: 1, ip: "10.42.200.1", index: 0},
+		{childSAs: 2, ip: "10.42.1.1", index: 0},
+		{childSAs: 2, ip: "10.42.200.1", index: 1},
+		{childSAs: 4, ip: "10.42.100.1", index: 1},
+		{childSAs: 4, ip: "10.42.200.1", index: 3},
+		{childSAs: 3, ip: "10.42.200.1", index: 0},
+		{childSAs: 2, ip: "fd00::8000:0:0:1", index: 1},
+		{childSAs: 4, ip: "192.168.1.1", index: 0},
+	}
+
+	for _, test := range tests {
+		o.ChildSAs = test.childSAs
+		if index := o.childIndex(net.ParseIP(test.ip)); index != test.index {
+			t.Errorf("%s with %d CHILD_SAs: expected %d, got %d", test.ip, test.childSAs, test.index, index)
+		}
+	}
+}
+
+func TestInSelectors(t *testing.T) {
+	o, cleanup := newTestOverlay(t, testStore{LocalSubnet: "10.42.0.0/16"})
+	defer cleanup()
+	o.ReqID = reqID
+
+	tests := []struct {
+		childSAs  int
+		selectors map[string]int
+	}{
+		{childSAs: 1, selectors: map[string]int{"10.42.0.0/16": reqID}},
+		{childSAs: 2, selectors: map[string]int{"10.42.0.0/17": reqID, "10.42.128.0/17": reqID + 1}},
+		{childSAs: 3, selectors: map[string]int{
+			"10.42.0.0/18":   reqID,
+			"10.42.64.0/18":  reqID + 1,
+			"10.42.128.0/18": reqID + 2,
+			"10.42.192.0/18": reqID,
+		}},
+	}
+
+	for _, test := range tests {
+		o.ChildSAs = test.childSAs
+		selectors := map[string]int{}
+		for _, s := range o.inSelectors(mustCIDR(t, "10.42.0.0/16")) {
+			selectors[s.dst.String()] = s.reqid
+		}
+		if !reflect.DeepEqual(selectors, test.selectors) {
+			t.Errorf("%d CHILD_SAs: expected %v, got %v", test.childSAs, test.selectors, selectors)
+		}
+	}
+}
+
+func TestOwnsPolicy(t *testing.T) {
+	o, cleanup := newTestOverlay(t, testStore{LocalSubnet: "10.42.0.0/16"})
+	defer cleanup()
+	o.ReqID = reqID
+	o.ChildSAs = 1
+
+	other, cleanupOther := newTestOverlay(t, testStore{LocalSubnet: "10.50.0.0/16"})
+	defer cleanupOther()
+	blue, err := o.AddNetwork("blue", 7, other.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel := func(reqid int) *netlink.XfrmPolicy {
+		return &netlink.XfrmPolicy{
+			Dst:   mustCIDR(t, "10.42.0.0/16"),
+			Tmpls: []netlink.XfrmPolicyTmpl{{Reqid: reqid}},
+		}
+	}
+	tests := []struct {
+		name   string
+		policy *netlink.XfrmPolicy
+		owner  *Overlay
+	}{
+		{name: "first CHILD_SA", policy: tunnel(reqID), owner: o},
+		{name: "CHILD_SA of a run with more", policy: tunnel(reqID + 5), owner: o},
+		{name: "last CHILD_SA", policy: tunnel(reqID + MaxChildSAs - 1), owner: o},
+		{name: "past the CHILD_SAs", policy: tunnel(reqID + MaxChildSAs)},
+		{name: "below the CHILD_SAs", policy: tunnel(reqID - 1)},
+		{name: "CHILD_SA of the network", policy: tunnel(blue.ReqID + 1), owner: blue},
+		{name: "any reqid to the local subnet", policy: tunnel(0), owner: o},
+		{
+			name:   "block of the local subnet",
+			policy: &netlink.XfrmPolicy{Priority: o.blockPriority(), Dst: mustCIDR(t, "10.42.0.0/16")},
+			owner:  o,
+		},
+		{
+			name:   "block of the local subnet of the network",
+			policy: &netlink.XfrmPolicy{Priority: blue.blockPriority(), Src: mustCIDR(t, "10.50.0.0/16")},
+			owner:  blue,
+		},
+		{
+			name:   "block of another subnet",
+			policy: &netlink.XfrmPolicy{Priority: o.blockPriority(), Dst: mustCIDR(t, "10.43.0.0/16")},
+		},
+		{
+			name:   "VXLAN block",
+			policy: &netlink.XfrmPolicy{Priority: o.vxlanBlockPriority(), Proto: netlink.Proto(syscall.IPPROTO_UDP)},
+			owner:  o,
+		},
+		{
+			name:   "VXLAN priority without UDP",
+			policy: &netlink.XfrmPolicy{Priority: o.vxlanBlockPriority(), Proto: netlink.Proto(syscall.IPPROTO_TCP)},
+		},
+	}
+
+	for _, test := range tests {
+		for _, overlay := range []*Overlay{o, blue} {
+			if owns := overlay.ownsPolicy(test.policy); owns != (overlay == test.owner) {
+				t.Errorf("%s: network %q owns it: %v", test.name, overlay.Network, owns)
+			}
+		}
+	}
+}
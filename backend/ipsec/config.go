@@ -0,0 +1,89 @@
+package ipsec
+
+import (
+	"sort"
+
+	"github.com/bronze1man/goStrongswanVici"
+)
+
+// EffectiveConfig describes the configuration the overlay applies to
+// the connections to its peers
+type EffectiveConfig struct {
+	TemplateRevision     string                              `json:"templateRevision"`
+	IkeConfSource        string                              `json:"ikeConfSource"`
+	ChildSaConfSource    string                              `json:"childSaConfSource"`
+	Blacklist            []string                            `json:"blacklist"`
+	RemovedProposals     []string                            `json:"removedProposals"`
+	RemovedESPProposals  []string                            `json:"removedEspProposals"`
+	IkeSaRekeyInterval   string                              `json:"ikeSaRekeyInterval"`
+	ChildSaRekeyInterval string                              `json:"childSaRekeyInterval"`
+	ReplayWindowSize     string                              `json:"replayWindowSize"`
+	Underlay             string                              `json:"underlay"`
+	EndpointSelection    string                              `json:"endpointSelection"`
+	AllowedPeerGroups    []string                            `json:"allowedPeerGroups"`
+	Gateways             bool                                `json:"gateways"`
+	Sites                []string                            `json:"sites"`
+	Network              string                              `json:"network,omitempty"`
+	NetworkID            int                                 `json:"networkId,omitempty"`
+	ReqID                int                                 `json:"reqId"`
+	ChildSAs             int                                 `json:"childSas"`
+	Mode                 string                              `json:"mode"`
+	VXLANPort            int                                 `json:"vxlanPort,omitempty"`
+	Networks             []EffectiveConfig                   `json:"networks,omitempty"`
+	Connections          map[string]goStrongswanVici.IKEConf `json:"connections"`
+}
+
+// EffectiveConfig returns the configuration currently used for the
+// connections, rendered from the templates for every remote host
+func (o *Overlay) EffectiveConfig() interface{} {
+	o.Lock()
+	defer o.Unlock()
+
+	config := EffectiveConfig{
+		TemplateRevision:     o.templates.Revision(),
+		IkeConfSource:        o.templates.IkeConfSource(),
+		ChildSaConfSource:    o.templates.ChildSaConfSource(),
+		Blacklist:            o.Blacklist,
+		RemovedProposals:     o.removedAlgos(o.templates.NewIkeConf().Proposals),
+		RemovedESPProposals:  o.removedAlgos(o.templates.NewChildSaConf().ESPProposals),
+		IkeSaRekeyInterval:   o.IPSecIkeSaRekeyInterval,
+		ChildSaRekeyInterval: o.IPSecChildSaRekeyInterval,
+		ReplayWindowSize:     o.ReplayWindowSize,
+		Underlay:             o.Underlay,
+		EndpointSelection:    o.EndpointSelection,
+		AllowedPeerGroups:    []string{},
+		Gateways:             o.Gateways,
+		Sites:                o.siteNames(),
+		Network:              o.Network,
+		NetworkID:            o.NetworkID,
+		ReqID:                o.ReqID,
+		ChildSAs:             o.childSAs(),
+		Mode:                 o.Mode,
+		Connections:          map[string]goStrongswanVici.IKEConf{},
+	}
+	if o.Mode == ModeVXLAN {
+		config.VXLANPort = o.vxlanPort()
+	}
+	for pair := range o.AllowedPeerGroups {
+		config.AllowedPeerGroups = append(config.AllowedPeerGroups, pair)
+	}
+	sort.Strings(config.AllowedPeerGroups)
+	for _, n := range o.networks {
+		config.Networks = append(config.Networks, n.EffectiveConfig().(EffectiveConfig))
+	}
+
+	localHostIP := o.db.LocalHostIPAddress()
+	gateways := o.siteGateways()
+	for _, entry := range o.db.Entries() {
+		if entry.HostIPAddress == localHostIP || !o.peerAllowed(entry) {
+			continue
+		}
+		hop := o.nextHop(entry, gateways)
+		name := o.connName(hop.HostIPAddress)
+		if _, ok := config.Connections[name]; !ok {
+			config.Connections[name] = o.newHostConnection(hop)
+		}
+	}
+
+	return config
+}
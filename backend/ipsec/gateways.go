@@ -0,0 +1,85 @@
+package ipsec
+
+import (
+	"net"
+
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+	"github.com/rancher/ipsec/store"
+	"github.com/vishvananda/netlink"
+)
+
+// site returns the region, or the environment with EndpointByEnvironment,
+// of the host of the entry
+func (o *Overlay) site(entry store.Entry) string {
+	if o.EndpointSelection == EndpointByEnvironment {
+		return entry.HostEnvironment
+	}
+	return entry.HostRegion
+}
+
+// siteGateways returns the gateway host of every site, picking the one
+// with the lowest IP when several hosts of a site are labeled, so all the
+// agents agree on it
+func (o *Overlay) siteGateways() map[string]store.Entry {
+	gateways := map[string]store.Entry{}
+	if !o.Gateways {
+		return gateways
+	}
+
+	for _, entry := range o.db.Entries() {
+		if !entry.HostGateway {
+			continue
+		}
+		site := o.site(entry)
+		if gw, ok := gateways[site]; !ok || entry.HostIPAddress < gw.HostIPAddress {
+			gateways[site] = entry
+		}
+	}
+	return gateways
+}
+
+// nextHop returns the entry of the host the traffic to the given entry is
+// tunneled to. Hosts in the same site, or in sites without a gateway,
+// reach each other directly. Otherwise the gateways hold the tunnels
+// between the sites and the other hosts go through their local gateway.
+func (o *Overlay) nextHop(entry store.Entry, gateways map[string]store.Entry) store.Entry {
+	local := o.db.LocalEntry()
+	localSite, remoteSite := o.site(local), o.site(entry)
+	if localSite == remoteSite {
+		return entry
+	}
+
+	localGateway, ok := gateways[localSite]
+	if !ok {
+		return entry
+	}
+	remoteGateway, ok := gateways[remoteSite]
+	if !ok {
+		return entry
+	}
+
+	if localGateway.HostIPAddress == local.HostIPAddress {
+		return remoteGateway
+	}
+	return localGateway
+}
+
+// addTransitRules adds, on a gateway, the policies carrying the traffic
+// between the other sites and the IP of an entry on a host of the local
+// site. The CHILD_SAs select any traffic already, so only the policies
+// need to follow the routing.
+func (o *Overlay) addTransitRules(entry store.Entry, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
+	_, ipDirectNet, err := xfrm.Selectors(o.db, entry)
+	if err != nil || ipDirectNet == nil {
+		return err
+	}
+
+	anyNet := &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	if ipDirectNet.IP.To4() == nil {
+		anyNet = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+
+	// Less specific than the policies between the local subnet and
+	// the entry, which take precedence for the traffic of this host
+	return o.addTunnelRules(entry, anyNet, ipDirectNet, 10001, existingPolicies, policiesToAdd)
+}
@@ -0,0 +1,130 @@
+package ipsec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/ipsec/store"
+)
+
+// gatewayEntries are hosts in three regions: us and eu with gateways,
+// two of them labeled in us, and ap without any
+var gatewayEntries = []store.Entry{
+	{IPAddress: "10.42.0.1/16", HostIPAddress: "192.168.0.1", HostRegion: "us", HostEnvironment: "us-1"},
+	{IPAddress: "10.42.0.3/16", HostIPAddress: "192.168.0.3", HostRegion: "us", HostEnvironment: "us-1", HostGateway: true},
+	{IPAddress: "10.42.0.2/16", HostIPAddress: "192.168.0.2", HostRegion: "us", HostEnvironment: "us-2", HostGateway: true},
+	{IPAddress: "10.42.1.5/16", HostIPAddress: "10.0.0.5", HostRegion: "eu", HostEnvironment: "eu-1", HostGateway: true},
+	{IPAddress: "10.42.1.6/16", HostIPAddress: "10.0.0.6", HostRegion: "eu", HostEnvironment: "eu-1"},
+	{IPAddress: "10.42.2.1/16", HostIPAddress: "172.16.0.1", HostRegion: "ap", HostEnvironment: "ap-1"},
+}
+
+func newGatewayOverlay(t *testing.T, local store.Entry) (*Overlay, func()) {
+	local.Self = true
+	o, cleanup := newTestOverlay(t, testStore{
+		Self:        local,
+		Entries:     gatewayEntries,
+		LocalSubnet: "10.42.0.0/16",
+	})
+	o.Gateways = true
+	return o, cleanup
+}
+
+func TestSiteGateways(t *testing.T) {
+	tests := []struct {
+		gateways  bool
+		selection string
+		expected  map[string]string
+	}{
+		{gateways: false, selection: EndpointByRegion, expected: map[string]string{}},
+		{
+			gateways:  true,
+			selection: EndpointByRegion,
+			expected:  map[string]string{"us": "192.168.0.2", "eu": "10.0.0.5"},
+		},
+		{
+			gateways:  true,
+			selection: EndpointByEnvironment,
+			expected:  map[string]string{"us-1": "192.168.0.3", "us-2": "192.168.0.2", "eu-1": "10.0.0.5"},
+		},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newGatewayOverlay(t, gatewayEntries[0])
+		o.Gateways = test.gateways
+		o.EndpointSelection = test.selection
+
+		gateways := map[string]string{}
+		for site, entry := range o.siteGateways() {
+			gateways[site] = entry.HostIPAddress
+		}
+		if !reflect.DeepEqual(gateways, test.expected) {
+			t.Errorf("gateways %v by %s: expected %v, got %v", test.gateways, test.selection, test.expected, gateways)
+		}
+		cleanup()
+	}
+}
+
+func TestNextHop(t *testing.T) {
+	tests := []struct {
+		local    store.Entry
+		gateways bool
+		remote   string
+		expected string
+	}{
+		// Same site
+		{local: gatewayEntries[0], gateways: true, remote: "192.168.0.3", expected: "192.168.0.3"},
+		// Through the local gateway
+		{local: gatewayEntries[0], gateways: true, remote: "10.0.0.6", expected: "192.168.0.2"},
+		{local: gatewayEntries[0], gateways: true, remote: "10.0.0.5", expected: "192.168.0.2"},
+		// From the local gateway to the remote one
+		{local: gatewayEntries[2], gateways: true, remote: "10.0.0.6", expected: "10.0.0.5"},
+		{local: gatewayEntries[2], gateways: true, remote: "192.168.0.1", expected: "192.168.0.1"},
+		// The labeled host which isn't the gateway of its site
+		{local: gatewayEntries[1], gateways: true, remote: "10.0.0.6", expected: "192.168.0.2"},
+		// Sites without a gateway are reached directly
+		{local: gatewayEntries[0], gateways: true, remote: "172.16.0.1", expected: "172.16.0.1"},
+		{local: gatewayEntries[5], gateways: true, remote: "10.0.0.6", expected: "10.0.0.6"},
+		// Without gateways every host is reached directly
+		{local: gatewayEntries[0], gateways: false, remote: "10.0.0.6", expected: "10.0.0.6"},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newGatewayOverlay(t, test.local)
+		o.Gateways = test.gateways
+
+		var remote store.Entry
+		for _, entry := range gatewayEntries {
+			if entry.HostIPAddress == test.remote {
+				remote = entry
+			}
+		}
+		if hop := o.nextHop(remote, o.siteGateways()); hop.HostIPAddress != test.expected {
+			t.Errorf("from %s to %s: expected %s, got %s", test.local.HostIPAddress, test.remote, test.expected, hop.HostIPAddress)
+		}
+		cleanup()
+	}
+}
+
+func TestPeerEntries(t *testing.T) {
+	tests := []struct {
+		local    store.Entry
+		expected map[string]int
+	}{
+		{
+			local:    gatewayEntries[0],
+			expected: map[string]int{"192.168.0.3": 1, "192.168.0.2": 3, "172.16.0.1": 1},
+		},
+		{
+			local:    gatewayEntries[2],
+			expected: map[string]int{"192.168.0.1": 1, "192.168.0.3": 1, "10.0.0.5": 2, "172.16.0.1": 1},
+		},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newGatewayOverlay(t, test.local)
+		if entries := o.peerEntries(); !reflect.DeepEqual(entries, test.expected) {
+			t.Errorf("from %s: expected %v, got %v", test.local.HostIPAddress, test.expected, entries)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,79 @@
+package ipsec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+	"github.com/rancher/ipsec/store"
+	"github.com/vishvananda/netlink"
+)
+
+// DefaultPeerGroup is the group of the hosts without a peer group label
+const DefaultPeerGroup = "default"
+
+// ParsePeerGroupPairs parses the allowed pairs of peer groups, each one
+// written as "group1:group2". The pairs work in both directions.
+func ParsePeerGroupPairs(pairs []string) (map[string]bool, error) {
+	allowed := map[string]bool{}
+	for _, pair := range pairs {
+		groups := strings.Split(pair, ":")
+		if len(groups) != 2 || groups[0] == "" || groups[1] == "" {
+			return nil, fmt.Errorf("invalid peer group pair: %s", pair)
+		}
+		allowed[groups[0]+":"+groups[1]] = true
+		allowed[groups[1]+":"+groups[0]] = true
+	}
+	return allowed, nil
+}
+
+func peerGroup(entry store.Entry) string {
+	if entry.HostGroup == "" {
+		return DefaultPeerGroup
+	}
+	return entry.HostGroup
+}
+
+// peerAllowed checks whether tunnels to the host of the entry can be built.
+// Hosts in the same group always can, hosts in different groups only when
+// the pair of groups is allowed. Without any group labels every host is in
+// the default group and reaches every other one.
+func (o *Overlay) peerAllowed(entry store.Entry) bool {
+	local, remote := peerGroup(o.db.LocalEntry()), peerGroup(entry)
+	return local == remote || o.AllowedPeerGroups[local+":"+remote]
+}
+
+// addBlockRules adds the policies dropping the traffic between the local
+// subnet and the IP of an entry on a host outside the allowed groups, so
+// it's never sent in plain text
+func (o *Overlay) addBlockRules(entry store.Entry, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
+	localSubnet, ipDirectNet, err := xfrm.Selectors(o.db, entry)
+	if err != nil || localSubnet == nil {
+		return err
+	}
+
+	policies := []netlink.XfrmPolicy{
+		{
+			Src:      localSubnet,
+			Dst:      ipDirectNet,
+			Dir:      netlink.XFRM_DIR_OUT,
+			Priority: o.blockPriority(),
+			Action:   netlink.XFRM_POLICY_BLOCK,
+		},
+	}
+	for _, dir := range []netlink.Dir{netlink.XFRM_DIR_IN, netlink.XFRM_DIR_FWD} {
+		policies = append(policies, netlink.XfrmPolicy{
+			Src:      ipDirectNet,
+			Dst:      localSubnet,
+			Dir:      dir,
+			Priority: o.blockPriority(),
+			Action:   netlink.XFRM_POLICY_BLOCK,
+		})
+	}
+
+	for _, policy := range policies {
+		xfrm.Want(policy, existingPolicies, policiesToAdd)
+	}
+
+	return nil
+}
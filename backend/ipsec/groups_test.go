@@ -0,0 +1,78 @@
+package ipsec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/ipsec/store"
+)
+
+func TestParsePeerGroupPairs(t *testing.T) {
+	tests := []struct {
+		pairs   []string
+		allowed map[string]bool
+		err     bool
+	}{
+		{pairs: nil, allowed: map[string]bool{}},
+		{
+			pairs:   []string{"web:db"},
+			allowed: map[string]bool{"web:db": true, "db:web": true},
+		},
+		{
+			pairs:   []string{"web:db", "db:backup"},
+			allowed: map[string]bool{"web:db": true, "db:web": true, "db:backup": true, "backup:db": true},
+		},
+		{pairs: []string{"web"}, err: true},
+		{pairs: []string{"web:"}, err: true},
+		{pairs: []string{":db"}, err: true},
+		{pairs: []string{"web:db:backup"}, err: true},
+	}
+
+	for _, test := range tests {
+		allowed, err := ParsePeerGroupPairs(test.pairs)
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", test.pairs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.pairs, err)
+			continue
+		}
+		if !reflect.DeepEqual(allowed, test.allowed) {
+			t.Errorf("%v: expected %v, got %v", test.pairs, test.allowed, allowed)
+		}
+	}
+}
+
+func TestPeerAllowed(t *testing.T) {
+	tests := []struct {
+		localGroup  string
+		remoteGroup string
+		allowed     []string
+		expected    bool
+	}{
+		{expected: true},
+		{localGroup: "web", remoteGroup: "web", expected: true},
+		{localGroup: "web", remoteGroup: "db", expected: false},
+		{localGroup: "web", remoteGroup: "db", allowed: []string{"db:web"}, expected: true},
+		{localGroup: "web", remoteGroup: "backup", allowed: []string{"web:db"}, expected: false},
+		{localGroup: "", remoteGroup: DefaultPeerGroup, expected: true},
+		{localGroup: "", remoteGroup: "db", expected: false},
+		{localGroup: "", remoteGroup: "db", allowed: []string{DefaultPeerGroup + ":db"}, expected: true},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newTestOverlay(t, testStore{
+			Self: store.Entry{IPAddress: "10.42.0.1/16", HostIPAddress: "192.168.0.1", HostGroup: test.localGroup},
+		})
+		o.AllowedPeerGroups, _ = ParsePeerGroupPairs(test.allowed)
+
+		entry := store.Entry{IPAddress: "10.42.0.2/16", HostIPAddress: "192.168.0.2", HostGroup: test.remoteGroup}
+		if allowed := o.peerAllowed(entry); allowed != test.expected {
+			t.Errorf("%q to %q with %v: expected %v, got %v", test.localGroup, test.remoteGroup, test.allowed, test.expected, allowed)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,251 @@
+package ipsec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/log"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// stateFile keeps the connections loaded in charon, with the revision
+	// of the templates they were rendered from, so the next agent adopts
+	// them instead of loading them again when charon keeps running, and
+	// the SAs left in the kernel by the charon of the previous agent
+	stateFile = "state.json"
+
+	reapInterval = 10 * time.Second
+)
+
+// The SAs known to charon and the kernel, replaced by the tests
+var (
+	charonSAs     = listSas
+	xfrmStateList = netlink.XfrmStateList
+	xfrmStateDel  = netlink.XfrmStateDel
+)
+
+// handoverState is the content of the state file
+type handoverState struct {
+	Revisions map[string]string `json:"revisions"`
+	Endpoints map[string]string `json:"endpoints"`
+
+	// Orphans are the SPIs of the SAs to every host which no charon
+	// knows of anymore
+	Orphans map[string][]string `json:"orphans,omitempty"`
+}
+
+// loadState reads the state file left by the previous agent, an empty
+// state is returned when there's none or no state directory
+func (o *Overlay) loadState() handoverState {
+	state := handoverState{
+		Revisions: map[string]string{},
+		Endpoints: map[string]string{},
+	}
+	if o.StateDir == "" {
+		return state
+	}
+
+	content, err := ioutil.ReadFile(path.Join(o.StateDir, stateFile))
+	if os.IsNotExist(err) {
+		return state
+	}
+	if err == nil {
+		err = json.Unmarshal(content, &state)
+	}
+	if err != nil {
+		log.Errorf("Failed to read the state file, reloading all the connections: %v", err)
+		return handoverState{}
+	}
+	return state
+}
+
+// saveState writes the state file, through a temporary one so a crash
+// never leaves a partial one behind. Nothing is saved without a state
+// directory, the config directory may be read-only.
+func (o *Overlay) saveState() error {
+	if o.StateDir == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(handoverState{
+		Revisions: o.hosts,
+		Endpoints: o.endpoints,
+		Orphans:   o.orphans,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(o.StateDir, 0700); err != nil {
+		return err
+	}
+	file := path.Join(o.StateDir, stateFile)
+	if err := ioutil.WriteFile(file+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// Handover saves the state of the overlay, and of the additional
+// networks, for the next agent and kills the charon launched by the agent
+// without letting it delete its SAs, so the next agent can start its own.
+// The policies and SAs stay in the kernel and carry the traffic until the
+// charon of the next agent sets up new SAs, the next agent then removes
+// the ones recorded here.
+func (o *Overlay) Handover() error {
+	var firstErr error
+	for _, n := range o.networks {
+		if err := n.Handover(); err != nil {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to hand over network %s: %v", n.Network, err)
+		}
+	}
+
+	o.charonLock.Lock()
+	defer o.charonLock.Unlock()
+
+	o.Lock()
+	if o.charon != nil {
+		if err := o.recordOrphans(); err != nil {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to list the SAs to hand over: %v", err)
+		}
+	}
+	err := o.saveState()
+	o.Unlock()
+	if err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to save the state: %v", err)
+	}
+
+	if o.charon == nil {
+		return firstErr
+	}
+	o.charonDetached = true
+	log.Infof("Killing charon, PID %d, leaving its SAs for the next agent", o.charon.Pid)
+	if err := o.charon.Kill(); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to kill charon: %v", err)
+	}
+	return firstErr
+}
+
+// recordOrphans adds the SAs of charon to the ones the next agent removes
+// once they're replaced
+func (o *Overlay) recordOrphans() error {
+	sas, err := charonSAs()
+	if err != nil {
+		return err
+	}
+
+	if o.orphans == nil {
+		o.orphans = map[string][]string{}
+	}
+	prefix := o.connName("")
+	for _, conns := range sas {
+		for name, ikeSA := range conns {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			host := strings.TrimPrefix(name, prefix)
+			for _, childSA := range ikeSA.Child_sas {
+				o.orphans[host] = append(o.orphans[host], childSA.Spi_in, childSA.Spi_out)
+			}
+		}
+	}
+	return nil
+}
+
+// reapOrphans removes the SAs left by the charon of the previous agent
+// to every host once charon set up new ones, until there are none left or
+// the overlay is stopped
+func (o *Overlay) reapOrphans() {
+	for {
+		o.Lock()
+		left := len(o.orphans)
+		o.Unlock()
+		if left == 0 {
+			return
+		}
+
+		select {
+		case <-time.After(reapInterval):
+		case <-o.stop:
+			return
+		}
+
+		o.Lock()
+		err := o.removeOrphans(false)
+		o.Unlock()
+		if err != nil {
+			log.Errorf("Failed to remove the SAs of the previous agent: %v", err)
+		}
+	}
+}
+
+// removeOrphans removes the SAs left by the charon of the previous agent
+// to the hosts charon set up new SAs to, or to all the hosts. The caller
+// holds the lock.
+func (o *Overlay) removeOrphans(all bool) error {
+	if len(o.orphans) == 0 {
+		return nil
+	}
+
+	installed := map[string]bool{}
+	if !all {
+		sas, err := charonSAs()
+		if err != nil {
+			return err
+		}
+		for _, conns := range sas {
+			for name, ikeSA := range conns {
+				for _, childSA := range ikeSA.Child_sas {
+					if childSA.State == childInstalled {
+						installed[name] = true
+					}
+				}
+			}
+		}
+	}
+
+	states, err := xfrmStateList(netlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for host, spis := range o.orphans {
+		if !all && !installed[o.connName(host)] {
+			continue
+		}
+
+		orphaned := map[uint32]bool{}
+		for _, spi := range spis {
+			if value, err := strconv.ParseUint(spi, 16, 32); err == nil {
+				orphaned[uint32(value)] = true
+			}
+		}
+		removed := true
+		for _, state := range states {
+			if state.Proto != netlink.XFRM_PROTO_ESP || !orphaned[uint32(state.Spi)] || !o.ownsReqID(state.Reqid) {
+				continue
+			}
+			log.Infof("Removing SA %08x to %s of the previous agent", uint32(state.Spi), host)
+			if err := xfrmStateDel(&state); err != nil {
+				firstErr = backend.HandleErr(firstErr, err, "Failed to remove SA %08x: %v", uint32(state.Spi), err)
+				removed = false
+			}
+		}
+		if removed {
+			delete(o.orphans, host)
+		}
+	}
+
+	if err := o.saveState(); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to save the state: %v", err)
+	}
+	return firstErr
+}
@@ -0,0 +1,324 @@
+package ipsec
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/bronze1man/goStrongswanVici"
+	"github.com/vishvananda/netlink"
+)
+
+// stubSAs makes charon list the given SAs and the kernel hold the given
+// states, the SPIs of the states deleted are recorded in deleted. Deleting
+// the state with the SPI failSpi fails. It returns a function restoring
+// the real ones.
+func stubSAs(sas []map[string]goStrongswanVici.IkeSa, states []netlink.XfrmState, failSpi int, deleted *[]int) func() {
+	oldSAs, oldList, oldDel := charonSAs, xfrmStateList, xfrmStateDel
+	charonSAs = func() ([]map[string]goStrongswanVici.IkeSa, error) {
+		if sas == nil {
+			return nil, errors.New("charon isn't running")
+		}
+		return sas, nil
+	}
+	xfrmStateList = func(family int) ([]netlink.XfrmState, error) {
+		return states, nil
+	}
+	xfrmStateDel = func(state *netlink.XfrmState) error {
+		if state.Spi == failSpi {
+			return errors.New("failed")
+		}
+		*deleted = append(*deleted, state.Spi)
+		return nil
+	}
+	return func() {
+		charonSAs, xfrmStateList, xfrmStateDel = oldSAs, oldList, oldDel
+	}
+}
+
+// ikeSA returns an IKE_SA with a CHILD_SA in the given state for every
+// pair of SPIs
+func ikeSA(state string, spis ...string) goStrongswanVici.IkeSa {
+	sa := goStrongswanVici.IkeSa{Child_sas: map[string]goStrongswanVici.Child_sas{}}
+	for i := 0; i+1 < len(spis); i += 2 {
+		sa.Child_sas[spis[i]] = goStrongswanVici.Child_sas{State: state, Spi_in: spis[i], Spi_out: spis[i+1]}
+	}
+	return sa
+}
+
+func TestLoadState(t *testing.T) {
+	tests := []struct {
+		name     string
+		stateDir bool
+		content  string
+		expected handoverState
+	}{
+		{
+			name:     "no state directory",
+			content:  `{"revisions": {"10.0.0.2": "r1"}}`,
+			expected: handoverState{Revisions: map[string]string{}, Endpoints: map[string]string{}},
+		},
+		{
+			name:     "no state file",
+			stateDir: true,
+			expected: handoverState{Revisions: map[string]string{}, Endpoints: map[string]string{}},
+		},
+		{
+			name:     "state file",
+			stateDir: true,
+			content:  `{"revisions": {"10.0.0.2": "r1"}, "endpoints": {"10.0.0.2": "192.168.0.2"}, "orphans": {"10.0.0.3": ["c1", "c2"]}}`,
+			expected: handoverState{
+				Revisions: map[string]string{"10.0.0.2": "r1"},
+				Endpoints: map[string]string{"10.0.0.2": "192.168.0.2"},
+				Orphans:   map[string][]string{"10.0.0.3": {"c1", "c2"}},
+			},
+		},
+		{
+			name:     "corrupt state file",
+			stateDir: true,
+			content:  `{"revisions": `,
+			expected: handoverState{},
+		},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newTestOverlay(t, testStore{})
+		stateDir := path.Join(o.templates.ConfigDir, "state")
+		if test.stateDir {
+			o.StateDir = stateDir
+		}
+		if test.content != "" {
+			// Without a state directory a file left in the config
+			// directory is ignored too
+			for _, dir := range []string{stateDir, o.templates.ConfigDir} {
+				os.MkdirAll(dir, 0700)
+				if err := ioutil.WriteFile(path.Join(dir, stateFile), []byte(test.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		if state := o.loadState(); !reflect.DeepEqual(state, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, state)
+		}
+		cleanup()
+	}
+}
+
+func TestSaveState(t *testing.T) {
+	tests := []struct {
+		name     string
+		stateDir string
+		saved    bool
+	}{
+		{name: "no state directory"},
+		{name: "state directory", stateDir: "state", saved: true},
+		{name: "missing state directory", stateDir: "state/networks/blue", saved: true},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newTestOverlay(t, testStore{})
+		if test.stateDir != "" {
+			o.StateDir = path.Join(o.templates.ConfigDir, test.stateDir)
+		}
+		o.hosts = map[string]string{"10.0.0.2": "r1"}
+		o.endpoints = map[string]string{"10.0.0.2": "192.168.0.2"}
+		o.orphans = map[string][]string{"10.0.0.3": {"c1", "c2"}}
+
+		if err := o.saveState(); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+
+		// Nothing is written to the config directory, which may be
+		// read-only
+		if _, err := os.Stat(path.Join(o.templates.ConfigDir, stateFile)); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no state file in the config directory", test.name)
+		}
+
+		if test.saved {
+			if _, err := os.Stat(path.Join(o.StateDir, stateFile+".tmp")); !os.IsNotExist(err) {
+				t.Errorf("%s: expected the temporary file renamed", test.name)
+			}
+			state := o.loadState()
+			expected := handoverState{Revisions: o.hosts, Endpoints: o.endpoints, Orphans: o.orphans}
+			if !reflect.DeepEqual(state, expected) {
+				t.Errorf("%s: expected %+v, got %+v", test.name, expected, state)
+			}
+		}
+		cleanup()
+	}
+}
+
+func TestRecordOrphans(t *testing.T) {
+	tests := []struct {
+		name     string
+		orphans  map[string][]string
+		sas      []map[string]goStrongswanVici.IkeSa
+		expected map[string][]string
+		err      bool
+	}{
+		{
+			name: "SAs of the overlay",
+			sas: []map[string]goStrongswanVici.IkeSa{
+				{"conn-10.0.0.2": ikeSA(childInstalled, "c1", "c2")},
+				{"conn-10.0.0.3": ikeSA(childInstalled, "c3", "c4")},
+				{"blue-conn-10.0.0.2": ikeSA(childInstalled, "c5", "c6")},
+			},
+			expected: map[string][]string{
+				"10.0.0.2": {"c1", "c2"},
+				"10.0.0.3": {"c3", "c4"},
+			},
+		},
+		{
+			name:    "orphans of an earlier handover kept",
+			orphans: map[string][]string{"10.0.0.2": {"c1", "c2"}},
+			sas: []map[string]goStrongswanVici.IkeSa{
+				{"conn-10.0.0.2": ikeSA(childInstalled, "c3", "c4")},
+			},
+			expected: map[string][]string{"10.0.0.2": {"c1", "c2", "c3", "c4"}},
+		},
+		{
+			name:     "no SAs",
+			sas:      []map[string]goStrongswanVici.IkeSa{},
+			expected: map[string][]string{},
+		},
+		{
+			name:     "charon not running",
+			orphans:  map[string][]string{"10.0.0.2": {"c1", "c2"}},
+			expected: map[string][]string{"10.0.0.2": {"c1", "c2"}},
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newTestOverlay(t, testStore{})
+		restore := stubSAs(test.sas, nil, 0, &[]int{})
+		o.orphans = test.orphans
+
+		err := o.recordOrphans()
+		if test.err != (err != nil) {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		for _, spis := range o.orphans {
+			sort.Strings(spis)
+		}
+		if !reflect.DeepEqual(o.orphans, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, o.orphans)
+		}
+
+		restore()
+		cleanup()
+	}
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	o, cleanup := newTestOverlay(t, testStore{})
+	defer cleanup()
+	reqID := o.childReqID(0)
+
+	// The SPIs are the ones of the orphans, in hex, 0xc3 is also used by
+	// an SA of another network and 0xc9 by an AH one
+	states := []netlink.XfrmState{
+		{Proto: netlink.XFRM_PROTO_ESP, Spi: 0xc1, Reqid: reqID},
+		{Proto: netlink.XFRM_PROTO_ESP, Spi: 0xc2, Reqid: reqID},
+		{Proto: netlink.XFRM_PROTO_ESP, Spi: 0xc3, Reqid: reqID + 1},
+		{Proto: netlink.XFRM_PROTO_ESP, Spi: 0xc3, Reqid: networkReqIDBase + 7*MaxChildSAs},
+		{Proto: netlink.XFRM_PROTO_ESP, Spi: 0xc5, Reqid: reqID},
+		{Proto: netlink.XFRM_PROTO_AH, Spi: 0xc9, Reqid: reqID},
+	}
+	orphans := func() map[string][]string {
+		return map[string][]string{
+			"10.0.0.2": {"c1", "c2"},
+			"10.0.0.3": {"c3", "c4"},
+			"10.0.0.4": {"c5", "c6"},
+			"10.0.0.5": {"c9", "not-hex"},
+		}
+	}
+	// New SAs are installed to 10.0.0.2, 10.0.0.3 and 10.0.0.5, the one
+	// to 10.0.0.4 is still being set up
+	sas := []map[string]goStrongswanVici.IkeSa{
+		{"conn-10.0.0.2": ikeSA(childInstalled, "d1", "d2")},
+		{"conn-10.0.0.3": ikeSA(childInstalled, "d3", "d4")},
+		{"conn-10.0.0.4": ikeSA("INSTALLING", "d5", "d6")},
+		{"conn-10.0.0.5": ikeSA(childInstalled, "d9", "da")},
+	}
+
+	tests := []struct {
+		name     string
+		all      bool
+		sas      []map[string]goStrongswanVici.IkeSa
+		failSpi  int
+		deleted  []int
+		orphans  []string
+		err      bool
+		stateDir bool
+	}{
+		{
+			name:     "replaced ones",
+			sas:      sas,
+			deleted:  []int{0xc1, 0xc2, 0xc3},
+			orphans:  []string{"10.0.0.4"},
+			stateDir: true,
+		},
+		{
+			name:    "all of them",
+			all:     true,
+			deleted: []int{0xc1, 0xc2, 0xc3, 0xc5},
+			orphans: []string{},
+		},
+		{
+			name:    "failing to remove one",
+			sas:     sas,
+			failSpi: 0xc2,
+			deleted: []int{0xc1, 0xc3},
+			orphans: []string{"10.0.0.2", "10.0.0.4"},
+			err:     true,
+		},
+		{
+			name:    "charon not running",
+			deleted: []int{},
+			orphans: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"},
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		deleted := []int{}
+		restore := stubSAs(test.sas, states, test.failSpi, &deleted)
+		o.orphans = orphans()
+		o.StateDir = ""
+		if test.stateDir {
+			o.StateDir = path.Join(o.templates.ConfigDir, "state")
+		}
+
+		err := o.removeOrphans(test.all)
+		restore()
+
+		if test.err != (err != nil) {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		sort.Ints(deleted)
+		if !reflect.DeepEqual(deleted, test.deleted) {
+			t.Errorf("%s: expected SAs %x removed, got %x", test.name, test.deleted, deleted)
+		}
+		left := []string{}
+		for host := range o.orphans {
+			left = append(left, host)
+		}
+		sort.Strings(left)
+		if !reflect.DeepEqual(left, test.orphans) {
+			t.Errorf("%s: expected orphans left to %v, got %v", test.name, test.orphans, left)
+		}
+
+		// The orphans left are saved for the next agent
+		if test.stateDir {
+			if state := o.loadState(); !reflect.DeepEqual(state.Orphans, o.orphans) {
+				t.Errorf("%s: expected the orphans %v saved, got %v", test.name, o.orphans, state.Orphans)
+			}
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package ipsec
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -16,16 +15,23 @@ import (
 
 	"github.com/bronze1man/goStrongswanVici"
 	"github.com/rancher/go-rancher-metadata/metadata"
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+	"github.com/rancher/ipsec/events"
 	"github.com/rancher/ipsec/store"
 	"github.com/rancher/log"
 	"github.com/vishvananda/netlink"
 )
 
 const (
-	reqID    = 1234
-	reqIDStr = "1234"
-	pskFile  = "psk.txt"
-	pidFile  = "/var/run/charon.pid"
+	reqID   = 1234
+	pskFile = "psk.txt"
+	pidFile = "/var/run/charon.pid"
+
+	runHistorySize = 20
+
+	// terminateTimeout bounds the wait for an IKE_SA to be deleted, in ms
+	terminateTimeout = "2000"
 
 	// DefaultReplayWindowSize specifies the replay window size for charon
 	DefaultReplayWindowSize = "1024"
@@ -40,54 +46,236 @@ const (
 // Overlay is used to store information about the Overlay Network
 type Overlay struct {
 	sync.Mutex
+	runLock sync.Mutex
 
 	keyAttempt                map[string]bool
 	hostAttempt               map[string]bool
 	keys                      map[string]string
 	hosts                     map[string]string
+	endpoints                 map[string]string
+	vtiKeys                   map[string]uint32
 	templates                 Templates
+	sites                     map[string]site
 	db                        store.Store
 	mc                        metadata.Client
 	psk                       string
+	runner                    *backend.Runner
+	stop                      chan struct{}
+	stopOnce                  sync.Once
+	charonLock                sync.Mutex
+	charon                    *os.Process
+	charonDetached            bool
+	orphans                   map[string][]string
 	Blacklist                 []string
 	ReplayWindowSize          string
 	IPSecIkeSaRekeyInterval   string
 	IPSecChildSaRekeyInterval string
+	Underlay                  string
+	EndpointSelection         string
+	AllowedPeerGroups         map[string]bool
+	Gateways                  bool
+
+	// Network is the name of the network served by the overlay, empty
+	// for the one of the agent. Its ID, 0 for the agent network, sets
+	// the ReqID and the marks telling its SAs and policies apart from
+	// the ones of the other networks.
+	Network   string
+	NetworkID int
+	ReqID     int
+	networks  []*Overlay
+
+	// ChildSAs is the number of CHILD_SAs set up to every peer
+	ChildSAs int
+
+	// Mode is the data plane mode, ModePolicy, ModeInterface or ModeVXLAN
+	Mode string
+
+	// VXLANPort is the UDP port of the VXLAN traffic of the agent network
+	// and VXLANNetworkPortBase the one of the additional network with the
+	// ID 1 in the ModeVXLAN mode
+	VXLANPort            int
+	VXLANNetworkPortBase int
+
+	// StateDir keeps the state handed over to the next agent, none is
+	// kept when empty
+	StateDir string
 }
 
 // NewOverlay creates a new Overlay
 func NewOverlay(configDir string, db store.Store, mc metadata.Client) *Overlay {
+	stop := make(chan struct{})
 	return &Overlay{
 		mc: mc,
 		db: db,
 		templates: Templates{
 			ConfigDir: configDir,
 		},
-		keys:  map[string]string{},
-		hosts: map[string]string{},
+		keys:                 map[string]string{},
+		hosts:                map[string]string{},
+		endpoints:            map[string]string{},
+		runner:               backend.NewRunner(runHistorySize, stop),
+		stop:                 stop,
+		ReqID:                reqID,
+		ChildSAs:             DefaultChildSAs,
+		Mode:                 ModePolicy,
+		VXLANPort:            DefaultVXLANPort,
+		VXLANNetworkPortBase: DefaultVXLANNetworkPortBase,
+		Underlay:             UnderlayAuto,
+		EndpointSelection:    EndpointByRegion,
 	}
 }
 
 // Start begins/starts the overlay network
 func (o *Overlay) Start(launch bool, logFile string) {
 	if launch {
-		go runCharon(logFile)
+		go o.runCharon(logFile)
 	} else {
 		go o.monitorCharon()
 	}
 
-	go o.mc.OnChange(5, o.onChangeNoError)
+	go o.runner.Process(o.reload)
+	go o.mc.OnChange(5, o.onChange)
 
 	if err := o.loadConns(); err != nil {
 		log.Fatalf("Failed to load connections from charon: %v", err)
 	}
+	go o.reapOrphans()
+
+	for _, n := range o.networks {
+		go n.runner.Process(n.reload)
+		if err := n.loadConns(); err != nil {
+			log.Fatalf("Failed to load connections of network %s from charon: %v", n.Network, err)
+		}
+		go n.reapOrphans()
+	}
+}
+
+// Stop stops processing the reconcile runs, of the additional networks
+// too, watching charon and handling the metadata changes, and waits for
+// the runs in progress. Charon, the connections and the policies are left
+// as they are.
+func (o *Overlay) Stop() error {
+	for _, n := range o.networks {
+		n.Stop()
+	}
+
+	o.stopOnce.Do(func() {
+		close(o.stop)
+	})
+	o.runLock.Lock()
+	defer o.runLock.Unlock()
+	return nil
+}
+
+// Cleanup removes the policies, interfaces and connections of the overlay
+// and of the additional networks, terminating their SAs. The keys stay
+// loaded in charon as VICI doesn't support unloading them.
+func (o *Overlay) Cleanup() error {
+	var firstErr error
+	for _, n := range o.networks {
+		if err := n.Cleanup(); err != nil {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to clean up network %s: %v", n.Network, err)
+		}
+	}
+
+	o.Lock()
+	defer o.Unlock()
+	log.Infof("Cleaning up")
+
+	policies, err := o.getRules()
+	if err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to list rules: %v", err)
+	} else if _, err := xfrm.DeletePolicies(policies); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to remove policies: %v", err)
+	}
+
+	if err := o.syncInterfaces(map[string]string{}); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to remove interfaces: %v", err)
+	}
+	if err := o.removeVXLAN(); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to remove the VXLAN interface: %v", err)
+	}
+
+	if err := o.terminateHosts(); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to terminate the SAs: %v", err)
+	}
+	// Without any attempt all the connections are removed
+	o.hostAttempt = map[string]bool{}
+	if err := o.removeHosts(); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to remove connections: %v", err)
+	}
+
+	if err := o.removeOrphans(true); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to remove the SAs of the previous agent: %v", err)
+	}
+	if o.StateDir != "" {
+		if err := os.Remove(path.Join(o.StateDir, stateFile)); err != nil && !os.IsNotExist(err) {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to remove the state file: %v", err)
+		}
+	}
+
+	return firstErr
+}
+
+// terminateHosts tears down the IKE_SAs, and so the CHILD_SAs, of the
+// loaded connections
+func (o *Overlay) terminateHosts() error {
+	if len(o.hosts) == 0 {
+		return nil
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for host := range o.hosts {
+		name := o.connName(host)
+		err := client.Terminate(&goStrongswanVici.TerminateRequest{
+			Ike:     name,
+			Timeout: terminateTimeout,
+		})
+		if err != nil {
+			// There's nothing to terminate when the tunnel is down
+			log.Debugf("Failed to terminate %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// onChange ignores the changes once the overlay is stopped, the metadata
+// client keeps polling
+func (o *Overlay) onChange(version string) {
+	if o.stopped() {
+		return
+	}
+	o.Submit(backend.TriggerMetadata, version)
+}
 
+// stopped tells whether Stop was called
+func (o *Overlay) stopped() bool {
+	select {
+	case <-o.stop:
+		return true
+	default:
+		return false
+	}
 }
 
-func (o *Overlay) onChangeNoError(version string) {
-	if err := o.Reload(); err != nil {
-		log.Errorf("failed to reload overlay: %v", err)
+// Submit queues a reconcile of the overlay, and of the additional
+// networks, and returns the ID of the run which will carry it out
+func (o *Overlay) Submit(trigger backend.Trigger, version string) string {
+	for _, n := range o.networks {
+		n.Submit(trigger, version)
 	}
+
+	return o.runner.Submit(trigger, version)
+}
+
+// Runs returns the recent reconcile runs of the overlay
+func (o *Overlay) Runs() []backend.Run {
+	return o.runner.Runs()
 }
 
 // Test ...
@@ -121,12 +309,22 @@ func (o *Overlay) loadConns() error {
 	}
 
 	o.hosts = map[string]string{}
+	o.endpoints = map[string]string{}
 
+	// The connections with an unknown revision are loaded again on the
+	// next reconcile
+	state := o.loadState()
+	o.orphans = state.Orphans
+	prefix := o.connName("")
 	for _, conn := range conns {
-		for k := range conn {
-			if strings.HasPrefix(k, "conn-") {
+		for k, ikeConf := range conn {
+			if strings.HasPrefix(k, prefix) {
 				log.Infof("Found existing connection: %s", k)
-				o.hosts[strings.TrimPrefix(k, "conn-")] = o.templates.Revision()
+				host := strings.TrimPrefix(k, prefix)
+				o.hosts[host] = state.Revisions[host]
+				if len(ikeConf.RemoteAddrs) > 0 {
+					o.endpoints[host] = ikeConf.RemoteAddrs[0]
+				}
 			}
 		}
 	}
@@ -136,6 +334,26 @@ func (o *Overlay) loadConns() error {
 
 // Reload is used to refresh the state of the overlay network
 func (o *Overlay) Reload() error {
+	err := o.runner.Run(backend.TriggerStartup, o.reload)
+
+	for _, n := range o.networks {
+		if nErr := n.Reload(); nErr != nil {
+			err = backend.HandleErr(err, nErr, "Failed to reload network %s: %v", n.Network, nErr)
+		}
+	}
+	return err
+}
+
+func (o *Overlay) reload(run *backend.Run) error {
+	o.runLock.Lock()
+	defer o.runLock.Unlock()
+
+	if run.MetadataVersion == "" {
+		if version, err := o.mc.GetVersion(); err == nil {
+			run.MetadataVersion = version
+		}
+	}
+
 	if err := o.db.Reload(); err != nil {
 		return err
 	}
@@ -146,7 +364,7 @@ func (o *Overlay) Reload() error {
 	}
 	o.psk = strings.TrimSpace(string(content))
 
-	return o.configure()
+	return o.configure(run)
 }
 
 func (o *Overlay) monitorCharon() {
@@ -160,21 +378,31 @@ func (o *Overlay) monitorCharon() {
 		if pid == "" {
 			pid = newPid
 			log.Infof("Charon running PID: %s", pid)
+			events.Publish(events.CharonStarted, map[string]string{"pid": pid})
 		} else if pid != newPid {
+			events.Publish(events.CharonRestarted, map[string]string{"oldPid": pid, "pid": newPid})
+			// Give the subscribers a chance to get the event before exiting
+			events.Flush(events.DefaultFlushTimeout)
 			log.Fatalf("Charon restarted, old PID: %s, new PID: %s", pid, newPid)
 		} else {
 			o.Lock()
 			if err := Test(); err != nil {
 				log.Errorf("Killing charon due to: %v", err)
 				o.killCharon(pid)
+				events.Publish(events.CharonKilled, map[string]string{"pid": pid, "reason": err.Error()})
 			}
 			o.Unlock()
 		}
-		time.Sleep(2 * time.Second)
+
+		select {
+		case <-time.After(2 * time.Second):
+		case <-o.stop:
+			return
+		}
 	}
 }
 
-func runCharon(logFile string) {
+func (o *Overlay) runCharon(logFile string) {
 	// Ignore error
 	os.Remove("/var/run/charon.vici")
 
@@ -206,18 +434,30 @@ func runCharon(logFile string) {
 		Pdeathsig: syscall.SIGTERM,
 	}
 
-	log.Fatalf("charon exited: %v", cmd.Run())
-}
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("Failed to start charon: %v", err)
+	}
+	o.charonLock.Lock()
+	o.charon = cmd.Process
+	o.charonLock.Unlock()
+	events.Publish(events.CharonStarted, map[string]string{"pid": strconv.Itoa(cmd.Process.Pid)})
+
+	err := cmd.Wait()
+	events.Publish(events.CharonExited, map[string]string{"pid": strconv.Itoa(cmd.Process.Pid)})
 
-func handleErr(firstErr, err error, fmt string, args ...interface{}) error {
-	log.Errorf(fmt, args...)
-	if firstErr != nil {
-		return firstErr
+	o.charonLock.Lock()
+	detached := o.charonDetached
+	o.charonLock.Unlock()
+	if detached {
+		log.Infof("charon exited after the handover: %v", err)
+		return
 	}
-	return err
+	// Give the subscribers a chance to get the event before exiting
+	events.Flush(events.DefaultFlushTimeout)
+	log.Fatalf("charon exited: %v", err)
 }
 
-func (o *Overlay) configure() error {
+func (o *Overlay) configure(run *backend.Run) error {
 	o.Lock()
 	defer o.Unlock()
 	log.Infof("Reconfiguring")
@@ -225,6 +465,10 @@ func (o *Overlay) configure() error {
 	if err := o.templates.Reload(); err != nil {
 		return err
 	}
+	if err := o.loadSites(); err != nil {
+		return err
+	}
+	o.assignVTIKeys()
 
 	o.keyAttempt = map[string]bool{}
 	o.hostAttempt = map[string]bool{}
@@ -232,46 +476,111 @@ func (o *Overlay) configure() error {
 	var firstErr error
 	localHostIP := o.db.LocalHostIPAddress()
 	hosts := map[string]bool{}
+	peers := map[string]error{}
+	interfaces := map[string]bool{}
+	routes := map[string]string{}
+
+	gateways := o.siteGateways()
+	localSite := o.site(o.db.LocalEntry())
+	localGateway, isGateway := gateways[localSite]
+	isGateway = isGateway && localGateway.HostIPAddress == localHostIP
 
 	policiesToAdd := map[string]netlink.XfrmPolicy{}
 	existingPolicies, err := o.getRules()
 	if err != nil {
-		firstErr = handleErr(firstErr, err, "Failed to list rules for: %v", err)
+		firstErr = backend.HandleErr(firstErr, err, "Failed to list rules for: %v", err)
 	}
 
-	if err := o.loadSharedKey(""); err != nil {
-		firstErr = handleErr(firstErr, err, "Failed to load key for %any: %v", err)
+	if err := o.loadSharedKey("", o.psk); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to load key for %%any: %v", err)
 	}
 
 	for _, entry := range o.db.Entries() {
 		if entry.Peer {
-			if err := o.loadSharedKey(entry.IPAddress); err != nil {
-				firstErr = handleErr(firstErr, err, "Failed to set PSK for peer agent %s: %v", entry.IPAddress, err)
+			if err := o.loadSharedKey(entry.IPAddress, o.getPsk(entry)); err != nil {
+				firstErr = backend.HandleErr(firstErr, err, "Failed to set PSK for peer agent %s: %v", entry.IPAddress, err)
 			}
 		}
 
 		if localHostIP == entry.HostIPAddress {
 			continue
 		}
-		if !hosts[entry.HostIPAddress] {
-			if err := o.addHost(entry); err == nil {
-				hosts[entry.HostIPAddress] = true
+		if !o.peerAllowed(entry) {
+			if err := o.addBlockRules(entry, existingPolicies, policiesToAdd); err != nil {
+				firstErr = backend.HandleErr(firstErr, err, "Failed to add block rules for host %s, ip %s : %v", entry.HostIPAddress, entry.IPAddress, err)
+			}
+			continue
+		}
+		hop := o.nextHop(entry, gateways)
+		if !hosts[hop.HostIPAddress] {
+			if err := o.addHost(hop); err == nil {
+				hosts[hop.HostIPAddress] = true
 			} else {
-				firstErr = handleErr(firstErr, err, "Failed to setup host %s: %v", entry.HostIPAddress, err)
+				firstErr = backend.HandleErr(firstErr, err, "Failed to setup host %s: %v", hop.HostIPAddress, err)
+			}
+			if _, ok := peers[hop.HostIPAddress]; !ok {
+				peers[hop.HostIPAddress] = err
 			}
 		}
 
-		if err := o.addRules(entry, existingPolicies, policiesToAdd); err != nil {
-			firstErr = handleErr(firstErr, err, "Failed to add rules for host %s, ip %s : %v", entry.HostIPAddress, entry.IPAddress, err)
+		if o.Mode == ModeInterface || o.Mode == ModeVXLAN {
+			addHopRules := o.addInterface
+			if o.Mode == ModeVXLAN {
+				addHopRules = o.addVXLANRules
+			}
+			if !interfaces[hop.HostIPAddress] {
+				if err := addHopRules(hop, existingPolicies, policiesToAdd); err == nil {
+					interfaces[hop.HostIPAddress] = true
+				} else {
+					firstErr = backend.HandleErr(firstErr, err, "Failed to setup interface to host %s: %v", hop.HostIPAddress, err)
+					if peers[hop.HostIPAddress] == nil {
+						peers[hop.HostIPAddress] = err
+					}
+				}
+			}
+			// The gateways forward through the routes, no transit
+			// policies are needed
+			routes[strings.Split(entry.IPAddress, "/")[0]] = hop.HostIPAddress
+			continue
+		}
+
+		if err := o.addRules(entry, hop, existingPolicies, policiesToAdd); err != nil {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to add rules for host %s, ip %s : %v", entry.HostIPAddress, entry.IPAddress, err)
+			if peers[hop.HostIPAddress] == nil {
+				peers[hop.HostIPAddress] = err
+			}
 		}
+
+		if isGateway && o.site(entry) == localSite {
+			if err := o.addTransitRules(entry, existingPolicies, policiesToAdd); err != nil {
+				firstErr = backend.HandleErr(firstErr, err, "Failed to add transit rules for host %s, ip %s : %v", entry.HostIPAddress, entry.IPAddress, err)
+			}
+		}
+	}
+
+	if o.Mode == ModeVXLAN {
+		o.addVXLANBlockRule(existingPolicies, policiesToAdd)
+	}
+
+	run.Peers = backend.PeerResults(peers)
+
+	if firstErr == nil {
+		run.PoliciesRemoved, firstErr = xfrm.DeletePolicies(existingPolicies)
 	}
 
 	if firstErr == nil {
-		firstErr = o.deletePolicies(existingPolicies)
+		run.PoliciesAdded, firstErr = xfrm.AddPolicies(policiesToAdd)
 	}
 
 	if firstErr == nil {
-		firstErr = o.addPolicies(policiesToAdd)
+		vtiRoutes, vxlanRoutes := routes, map[string]string{}
+		if o.Mode == ModeVXLAN {
+			vtiRoutes, vxlanRoutes = vxlanRoutes, routes
+		}
+		firstErr = o.syncInterfaces(vtiRoutes)
+		if err := o.syncVXLAN(vxlanRoutes); err != nil {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to set up the VXLAN interface: %v", err)
+		}
 	}
 
 	if firstErr == nil {
@@ -279,6 +588,10 @@ func (o *Overlay) configure() error {
 		// Currently VICI doesn't support unloading keys
 	}
 
+	if err := o.saveState(); err != nil {
+		log.Errorf("Failed to save the state: %v", err)
+	}
+
 	return firstErr
 }
 
@@ -293,32 +606,6 @@ func (o *Overlay) killCharon(pid string) {
 	}
 }
 
-func (o *Overlay) deletePolicies(policies map[string]netlink.XfrmPolicy) error {
-	var lastErr error
-	for _, policy := range policies {
-		if err := netlink.XfrmPolicyDel(&policy); err != nil {
-			log.Errorf("Failed to delete policy: %+v, %v", policy, err)
-			lastErr = err
-		} else {
-			log.Infof("Deleted policy: %+v", policy)
-		}
-	}
-	return lastErr
-}
-
-func (o *Overlay) addPolicies(policies map[string]netlink.XfrmPolicy) error {
-	var lastErr error
-	for _, policy := range policies {
-		if err := netlink.XfrmPolicyAdd(&policy); err != nil {
-			log.Errorf("Failed to add policy: %+v, %v", policy, err)
-			lastErr = err
-		} else {
-			log.Infof("Added policy: %+v", policy)
-		}
-	}
-	return lastErr
-}
-
 func (o *Overlay) getRules() (map[string]netlink.XfrmPolicy, error) {
 	policies := map[string]netlink.XfrmPolicy{}
 	existing, err := netlink.XfrmPolicyList(0)
@@ -330,7 +617,10 @@ func (o *Overlay) getRules() (map[string]netlink.XfrmPolicy, error) {
 		if policy.Dir != netlink.XFRM_DIR_IN && policy.Dir != netlink.XFRM_DIR_FWD && policy.Dir != netlink.XFRM_DIR_OUT {
 			continue
 		}
-		policies[toKey(&policy)] = policy
+		if !o.ownsPolicy(&policy) {
+			continue
+		}
+		policies[xfrm.Key(&policy)] = policy
 	}
 
 	return policies, nil
@@ -342,10 +632,12 @@ func (o *Overlay) removeHosts() error {
 	for k := range o.hosts {
 		if !o.hostAttempt[k] {
 			if err := o.removeHost(k); err != nil {
-				firstErr = handleErr(firstErr, err, "Failed to add remove connection for host %s: %v", k, err)
+				firstErr = backend.HandleErr(firstErr, err, "Failed to add remove connection for host %s: %v", k, err)
 			} else {
 				log.Infof("Removed connection for %s", k)
 				delete(o.hosts, k)
+				delete(o.endpoints, k)
+				events.Publish(events.ConnectionRemoved, map[string]string{"host": k})
 			}
 		}
 	}
@@ -360,7 +652,7 @@ func (o *Overlay) removeHost(host string) error {
 	}
 	defer client.Close()
 
-	name := "conn-" + strings.Split(host, "/")[0]
+	name := o.connName(strings.Split(host, "/")[0])
 	log.Infof("Removing connection for %s", name)
 	return client.UnloadConn(&goStrongswanVici.UnloadConnRequest{
 		Name: name,
@@ -386,16 +678,19 @@ func getClient() (*goStrongswanVici.ClientConn, error) {
 }
 
 func (o *Overlay) addHost(entry store.Entry) error {
-	if err := o.loadSharedKey(entry.HostIPAddress); err != nil {
+	if err := o.loadSharedKey(entry.HostIPAddress, o.getPsk(entry)); err != nil {
 		return err
 	}
 
 	return o.addHostConnection(entry)
 }
 
-func (o *Overlay) loadSharedKey(ipAddress string) error {
+func (o *Overlay) loadSharedKey(ipAddress, key string) error {
 	ipAddress = strings.Split(ipAddress, "/")[0]
-	key := o.getPsk(ipAddress)
+	if ipAddress == "" && o.Network != "" {
+		// The key for %any belongs to the network of the agent
+		return nil
+	}
 
 	o.keyAttempt[ipAddress] = true
 	if o.keys[ipAddress] == key {
@@ -412,7 +707,7 @@ func (o *Overlay) loadSharedKey(ipAddress string) error {
 	sharedKey := &goStrongswanVici.Key{
 		Typ:    "IKE",
 		Data:   key,
-		Owners: []string{ipAddress},
+		Owners: []string{o.ikeID(ipAddress)},
 	}
 
 	err = client.LoadShared(sharedKey)
@@ -423,9 +718,26 @@ func (o *Overlay) loadSharedKey(ipAddress string) error {
 
 	o.keys[ipAddress] = key
 	log.Infof("Loaded pre-shared key for %s", ipAddress)
+	events.Publish(events.KeyLoaded, map[string]string{"owner": ipAddress})
 	return nil
 }
 
+func (o *Overlay) removedAlgos(algos []string) []string {
+	kept := map[string]bool{}
+	for _, algo := range o.filterAlgos(algos) {
+		kept[algo] = true
+	}
+
+	ret := []string{}
+	for _, algo := range algos {
+		if !kept[algo] {
+			ret = append(ret, algo)
+		}
+	}
+
+	return ret
+}
+
 func (o *Overlay) filterAlgos(algos []string) []string {
 	ret := []string{}
 	for _, algo := range algos {
@@ -446,7 +758,10 @@ func (o *Overlay) filterAlgos(algos []string) []string {
 
 func (o *Overlay) addHostConnection(entry store.Entry) error {
 	o.hostAttempt[entry.HostIPAddress] = true
-	if o.hosts[entry.HostIPAddress] == o.templates.Revision() {
+	endpoint := o.remoteEndpoint(entry)
+	revision := o.connRevision(entry)
+	if o.hosts[entry.HostIPAddress] == revision &&
+		o.endpoints[entry.HostIPAddress] == endpoint {
 		log.Debugf("Connection already loaded for host %s", entry.HostIPAddress)
 		return nil
 	}
@@ -457,30 +772,11 @@ func (o *Overlay) addHostConnection(entry store.Entry) error {
 	}
 	defer client.Close()
 
-	childSAConf := o.templates.NewChildSaConf()
-	childSAConf.ESPProposals = o.filterAlgos(childSAConf.ESPProposals)
-	childSAConf.ReqID = reqIDStr
-	childSAConf.RekeyTime = o.IPSecChildSaRekeyInterval
-	if strings.Compare(entry.HostIPAddress, o.db.LocalHostIPAddress()) < 0 {
-		childSAConf.RekeyTime = "8760h"
-	}
-	log.Infof("For entry: %v, using RekeyTime: %v", entry, childSAConf.RekeyTime)
-
+	ikeConf := o.newHostConnection(entry)
+	log.Infof("For entry: %v, using RekeyTime: %v", entry, ikeConf.RekeyTime)
 	log.Debugf("Using ReplayWindowSize: %v", o.ReplayWindowSize)
-	childSAConf.ReplayWindow = o.ReplayWindowSize
-
-	ikeConf := o.templates.NewIkeConf()
-	ikeConf.Proposals = o.filterAlgos(ikeConf.Proposals)
-	ikeConf.RemoteAddrs = []string{entry.HostIPAddress}
-	ikeConf.RekeyTime = o.IPSecIkeSaRekeyInterval
-	if strings.Compare(entry.HostIPAddress, o.db.LocalHostIPAddress()) < 0 {
-		ikeConf.RekeyTime = "8760h"
-	}
-	ikeConf.Children = map[string]goStrongswanVici.ChildSAConf{
-		"child-" + entry.HostIPAddress: childSAConf,
-	}
 
-	name := fmt.Sprintf("conn-%s", entry.HostIPAddress)
+	name := o.connName(entry.HostIPAddress)
 	// Loading connections doesn't seem to be very reliable, can't get info
 	// why it's failing though.
 	for i := 0; i < 3; i++ {
@@ -496,113 +792,133 @@ func (o *Overlay) addHostConnection(entry store.Entry) error {
 		return err
 	}
 
-	o.hosts[entry.HostIPAddress] = o.templates.Revision()
-	log.Infof("Loaded connection: %v, %v, %v", name, ikeConf.Proposals, childSAConf.ESPProposals)
+	o.hosts[entry.HostIPAddress] = revision
+	o.endpoints[entry.HostIPAddress] = endpoint
+	log.Infof("Loaded connection: %v, %v, %v", name, ikeConf.Proposals, ikeConf.Children[o.childSAName(entry.HostIPAddress, 0)].ESPProposals)
+	events.Publish(events.ConnectionLoaded, map[string]string{"host": entry.HostIPAddress, "name": name})
 
 	return nil
 }
 
-func toKey(p *netlink.XfrmPolicy) string {
-	buffer := bytes.Buffer{}
-	buffer.WriteString(p.Dir.String())
-	buffer.WriteRune('-')
-	if p.Src != nil {
-		buffer.WriteString(p.Src.String())
-	}
-	buffer.WriteRune('-')
-	if p.Dst != nil {
-		buffer.WriteString(p.Dst.String())
-	}
-	buffer.WriteRune('-')
-	if len(p.Tmpls) > 0 {
-		buffer.WriteString(p.Tmpls[0].Src.String())
-		buffer.WriteRune('-')
-		buffer.WriteString(p.Tmpls[0].Dst.String())
-		buffer.WriteRune('-')
-		buffer.WriteString(strconv.Itoa(p.Tmpls[0].Reqid))
+// connRevision returns the revision of the connection to the host of the
+// entry: the one of its templates and, when the key marking its SAs moved
+// off a collision, the key
+func (o *Overlay) connRevision(entry store.Entry) string {
+	revision := o.templatesFor(entry).Revision()
+	if key := o.vtiKey(entry.HostIPAddress); o.Mode == ModeInterface && key != o.mark()|o.vtiHash(entry.HostIPAddress) {
+		revision = fmt.Sprintf("%s-%08x", revision, key)
 	}
+	return revision
+}
 
-	return buffer.String()
+func (o *Overlay) connName(host string) string {
+	return fmt.Sprintf("%sconn-%s", o.namePrefix(), host)
 }
 
-func (o *Overlay) addRules(entry store.Entry, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
-	localIP := net.ParseIP(o.db.LocalIPAddress())
-	remoteHostIP := net.ParseIP(entry.HostIPAddress)
+func (o *Overlay) childName(host string) string {
+	return fmt.Sprintf("%schild-%s", o.namePrefix(), host)
+}
 
-	_, localSubnet, err := net.ParseCIDR(o.db.LocalSubnet())
-	if err != nil {
-		return err
+// newHostConnection renders the IKE config, including the CHILD_SA,
+// used for the connection to the host of the given entry
+func (o *Overlay) newHostConnection(entry store.Entry) goStrongswanVici.IKEConf {
+	templates := o.templatesFor(entry)
+	childSAConf := templates.NewChildSaConf()
+	childSAConf.ESPProposals = o.filterAlgos(childSAConf.ESPProposals)
+	childSAConf.RekeyTime = o.IPSecChildSaRekeyInterval
+	if strings.Compare(entry.HostIPAddress, o.db.LocalHostIPAddress()) < 0 {
+		childSAConf.RekeyTime = "8760h"
+	}
+	childSAConf.ReplayWindow = o.ReplayWindowSize
+	if o.Mode == ModeInterface {
+		mark := strconv.FormatUint(uint64(o.vtiKey(entry.HostIPAddress)), 10)
+		childSAConf.MarkIn = mark
+		childSAConf.MarkOut = mark
+	}
+	if o.Mode == ModeVXLAN {
+		// Only the VXLAN traffic between the hosts goes through the SAs
+		childSAConf.Mode = "transport"
+		childSAConf.Local_ts = []string{"dynamic[udp]"}
+		childSAConf.Remote_ts = []string{"dynamic[udp]"}
 	}
 
-	ip, _, err := net.ParseCIDR(entry.IPAddress)
-	if err != nil {
-		return err
+	ikeConf := templates.NewIkeConf()
+	ikeConf.Proposals = o.filterAlgos(ikeConf.Proposals)
+	ikeConf.RemoteAddrs = []string{o.remoteEndpoint(entry)}
+	ikeConf.RekeyTime = o.IPSecIkeSaRekeyInterval
+	if strings.Compare(entry.HostIPAddress, o.db.LocalHostIPAddress()) < 0 {
+		ikeConf.RekeyTime = "8760h"
 	}
+	// The keys belong to the host IPs, the endpoints differ from them
+	// over IPv6 or when set through the labels
+	ikeConf.LocalAuth.ID = o.ikeID(o.db.LocalHostIPAddress())
+	ikeConf.RemoteAuth.ID = o.ikeID(entry.HostIPAddress)
+	ikeConf.Children = o.childSAConfs(entry.HostIPAddress, childSAConf)
+
+	return ikeConf
+}
 
-	_, ipDirectNet, err := net.ParseCIDR(fmt.Sprintf("%s/32", ip))
+// addRules adds the policies between the local subnet and the IP of the
+// entry, tunneled to the host of hop
+func (o *Overlay) addRules(entry, hop store.Entry, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
+	localSubnet, ipDirectNet, err := xfrm.Selectors(o.db, entry)
 	if err != nil {
 		return err
 	}
+	if localSubnet == nil {
+		log.Debugf("Skipping %s, the local network has no IPv6 subnet", entry.IPAddress)
+		return nil
+	}
+
+	return o.addTunnelRules(hop, localSubnet, ipDirectNet, 10000, existingPolicies, policiesToAdd)
+}
+
+// addTunnelRules adds the out, in and fwd policies between the local and
+// remote networks, tunneled to the host of hop
+func (o *Overlay) addTunnelRules(hop store.Entry, localNet, remoteNet *net.IPNet, priority int, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
+	remoteEndpoint := o.remoteEndpoint(hop)
+	localIP := net.ParseIP(o.localEndpoint(remoteEndpoint))
+	remoteHostIP := net.ParseIP(remoteEndpoint)
 
 	outPolicy := netlink.XfrmPolicy{
-		Src:      localSubnet,
-		Dst:      ipDirectNet,
+		Src:      localNet,
+		Dst:      remoteNet,
 		Dir:      netlink.XFRM_DIR_OUT,
-		Priority: 10000,
+		Priority: priority,
 		Tmpls: []netlink.XfrmPolicyTmpl{
 			{
 				Src:   localIP,
 				Dst:   remoteHostIP,
 				Proto: netlink.XFRM_PROTO_ESP,
 				Mode:  netlink.XFRM_MODE_TUNNEL,
-				Reqid: reqID,
-			},
-		},
-	}
-	inPolicy := netlink.XfrmPolicy{
-		Src:      ipDirectNet,
-		Dst:      localSubnet,
-		Dir:      netlink.XFRM_DIR_IN,
-		Priority: 10000,
-		Tmpls: []netlink.XfrmPolicyTmpl{
-			{
-				Src:   remoteHostIP,
-				Dst:   localIP,
-				Proto: netlink.XFRM_PROTO_ESP,
-				Mode:  netlink.XFRM_MODE_TUNNEL,
-				Reqid: reqID,
+				Reqid: o.outReqID(remoteNet),
 			},
 		},
 	}
-	fwdPolicy := netlink.XfrmPolicy{
-		Src:      ipDirectNet,
-		Dst:      localSubnet,
-		Dir:      netlink.XFRM_DIR_FWD,
-		Priority: 10000,
-		Tmpls: []netlink.XfrmPolicyTmpl{
-			{
-				Src:   remoteHostIP,
-				Dst:   localIP,
-				Proto: netlink.XFRM_PROTO_ESP,
-				Mode:  netlink.XFRM_MODE_TUNNEL,
-				Reqid: reqID,
-			},
-		},
-	}
-
-	var lastErr error
-	for _, policy := range []netlink.XfrmPolicy{outPolicy, inPolicy, fwdPolicy} {
-		key := toKey(&policy)
-		if _, ok := existingPolicies[key]; ok {
-			delete(existingPolicies, key)
-		} else {
-			policiesToAdd[key] = policy
+	policies := []netlink.XfrmPolicy{outPolicy}
+	for _, selector := range o.inSelectors(localNet) {
+		for _, dir := range []netlink.Dir{netlink.XFRM_DIR_IN, netlink.XFRM_DIR_FWD} {
+			policies = append(policies, netlink.XfrmPolicy{
+				Src:      remoteNet,
+				Dst:      selector.dst,
+				Dir:      dir,
+				Priority: priority,
+				Tmpls: []netlink.XfrmPolicyTmpl{
+					{
+						Src:   remoteHostIP,
+						Dst:   localIP,
+						Proto: netlink.XFRM_PROTO_ESP,
+						Mode:  netlink.XFRM_MODE_TUNNEL,
+						Reqid: selector.reqid,
+					},
+				},
+			})
 		}
 	}
 
-	return lastErr
-}
+	for _, policy := range policies {
+		xfrm.Want(policy, existingPolicies, policiesToAdd)
+	}
 
-func (o *Overlay) getPsk(hostIP string) string {
-	return o.psk
+	return nil
 }
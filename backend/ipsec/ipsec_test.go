@@ -0,0 +1,83 @@
+package ipsec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rancher/ipsec/store"
+)
+
+func TestHostConnectionIDs(t *testing.T) {
+	local := store.Entry{IPAddress: "10.42.0.1/16", HostIPAddress: "192.168.0.1", HostIPv6Address: "fd00::1", HostRegion: "us", Self: true}
+	tests := []struct {
+		name     string
+		network  string
+		underlay string
+		remote   store.Entry
+		addrs    []string
+		localID  string
+		remoteID string
+	}{
+		{
+			name:     "host IP",
+			remote:   store.Entry{IPAddress: "10.42.0.2/16", HostIPAddress: "192.168.0.2", HostRegion: "us"},
+			addrs:    []string{"192.168.0.2"},
+			localID:  "192.168.0.1",
+			remoteID: "192.168.0.2",
+		},
+		{
+			name:     "private endpoint",
+			remote:   store.Entry{IPAddress: "10.42.0.2/16", HostIPAddress: "192.168.0.2", HostRegion: "us", PrivateEndpoint: "172.31.0.2"},
+			addrs:    []string{"172.31.0.2"},
+			localID:  "192.168.0.1",
+			remoteID: "192.168.0.2",
+		},
+		{
+			name:     "public endpoint",
+			remote:   store.Entry{IPAddress: "10.42.0.2/16", HostIPAddress: "192.168.0.2", HostRegion: "eu", PublicEndpoint: "203.0.113.2"},
+			addrs:    []string{"203.0.113.2"},
+			localID:  "192.168.0.1",
+			remoteID: "192.168.0.2",
+		},
+		{
+			name:     "IPv6 underlay",
+			underlay: UnderlayIPv6,
+			remote:   store.Entry{IPAddress: "10.42.0.2/16", HostIPAddress: "192.168.0.2", HostIPv6Address: "fd00::2", HostRegion: "us"},
+			addrs:    []string{"fd00::2"},
+			localID:  "192.168.0.1",
+			remoteID: "192.168.0.2",
+		},
+		{
+			name:     "additional network",
+			network:  "blue",
+			remote:   store.Entry{IPAddress: "10.42.0.2/16", HostIPAddress: "192.168.0.2", HostRegion: "us"},
+			addrs:    []string{"192.168.0.2"},
+			localID:  "192.168.0.1@blue",
+			remoteID: "192.168.0.2@blue",
+		},
+	}
+
+	for _, test := range tests {
+		o, cleanup := newTestOverlay(t, testStore{
+			Self:        local,
+			Entries:     []store.Entry{local, test.remote},
+			LocalSubnet: "10.42.0.0/16",
+		})
+		o.Network = test.network
+		if test.underlay != "" {
+			o.Underlay = test.underlay
+		}
+		if err := o.templates.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		conf := o.newHostConnection(test.remote)
+		if !reflect.DeepEqual(conf.RemoteAddrs, test.addrs) {
+			t.Errorf("%s: expected the remote addresses %v, got %v", test.name, test.addrs, conf.RemoteAddrs)
+		}
+		if conf.LocalAuth.ID != test.localID || conf.RemoteAuth.ID != test.remoteID {
+			t.Errorf("%s: expected the IDs %s and %s, got %s and %s", test.name, test.localID, test.remoteID, conf.LocalAuth.ID, conf.RemoteAuth.ID)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,155 @@
+package ipsec
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/rancher/ipsec/store"
+	"github.com/vishvananda/netlink"
+)
+
+// networksDir holds a directory for every additional network, with the
+// psk.txt, templates and sites used for it
+const networksDir = "networks"
+
+const (
+	// MaxNetworkID is the highest ID of an additional network, the agent
+	// network has the ID 0
+	MaxNetworkID = 255
+
+	// networkReqIDBase is above the reqids of the CHILD_SAs of the agent
+	// network, each additional network gets MaxChildSAs reqids from there
+	networkReqIDBase = 1 << 16
+
+	// The ID of the network is the top byte of the marks of its
+	// interfaces and SAs
+	networkMarkShift = 24
+	networkMarkMask  = 0xff << networkMarkShift
+)
+
+// NetworkID returns the ID of the network derived from its name, so every
+// host agrees on it whatever the order the networks are listed in
+func NetworkID(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32()%MaxNetworkID) + 1
+}
+
+// ParseNetwork parses an additional network written as "name" or
+// "name:id", the ID being derived from the name when not set
+func ParseNetwork(network string) (string, int, error) {
+	parts := strings.Split(network, ":")
+	if parts[0] == "" || len(parts) > 2 {
+		return "", 0, fmt.Errorf("invalid network: %s", network)
+	}
+	if len(parts) == 1 {
+		return parts[0], NetworkID(parts[0]), nil
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil || id < 1 || id > MaxNetworkID {
+		return "", 0, fmt.Errorf("invalid network ID of %s: %s, must be between 1 and %d", parts[0], parts[1], MaxNetworkID)
+	}
+	return parts[0], id, nil
+}
+
+// AddNetwork creates the overlay serving an additional network, using the
+// given store, next to the one of the agent. It shares charon and the
+// settings of this overlay but gets its own reqids and marks, derived
+// from the ID of the network, connections, key and policies, so no SA
+// carries the traffic of several networks.
+func (o *Overlay) AddNetwork(name string, id int, db store.Store) (*Overlay, error) {
+	for _, n := range o.networks {
+		if n.NetworkID == id {
+			return nil, fmt.Errorf("networks %s and %s have the same ID %d, set one explicitly", n.Network, name, id)
+		}
+	}
+
+	n := NewOverlay(path.Join(o.templates.ConfigDir, networksDir, name), db, o.mc)
+	n.Network = name
+	n.NetworkID = id
+	n.ReqID = networkReqIDBase + id*MaxChildSAs
+	if o.StateDir != "" {
+		n.StateDir = path.Join(o.StateDir, networksDir, name)
+	}
+	n.Blacklist = o.Blacklist
+	n.ReplayWindowSize = o.ReplayWindowSize
+	n.IPSecIkeSaRekeyInterval = o.IPSecIkeSaRekeyInterval
+	n.IPSecChildSaRekeyInterval = o.IPSecChildSaRekeyInterval
+	n.Underlay = o.Underlay
+	n.EndpointSelection = o.EndpointSelection
+	n.AllowedPeerGroups = o.AllowedPeerGroups
+	n.Gateways = o.Gateways
+	n.ChildSAs = o.ChildSAs
+	n.Mode = o.Mode
+	n.VXLANPort = o.VXLANPort
+	n.VXLANNetworkPortBase = o.VXLANNetworkPortBase
+
+	o.networks = append(o.networks, n)
+	return n, nil
+}
+
+// mark returns the bits the ID of the network sets in the marks
+func (o *Overlay) mark() uint32 {
+	return uint32(o.NetworkID) << networkMarkShift
+}
+
+// blockPriority returns the priority of the policies blocking the traffic
+// to the hosts outside the allowed groups. It tells apart the ones of the
+// networks sharing a subnet.
+func (o *Overlay) blockPriority() int {
+	return 10000 + o.NetworkID
+}
+
+// namePrefix namespaces the connections of the additional networks
+func (o *Overlay) namePrefix() string {
+	if o.Network == "" {
+		return ""
+	}
+	return o.Network + "-"
+}
+
+// ikeID returns the IKE identity of the host for the network. The agent
+// network uses the host IP, the additional ones need their own so charon
+// picks the right key and connection for the same pair of hosts.
+func (o *Overlay) ikeID(hostIP string) string {
+	if o.Network == "" || hostIP == "" {
+		return hostIP
+	}
+	return hostIP + "@" + o.Network
+}
+
+// ownsPolicy tells whether the policy was set up by the overlay: either
+// tunneled with its reqids, blocking its VXLAN traffic or blocking the
+// traffic of its local subnet with its priority
+func (o *Overlay) ownsPolicy(p *netlink.XfrmPolicy) bool {
+	if len(p.Tmpls) > 0 {
+		if p.Tmpls[0].Reqid == 0 {
+			return o.ownsAnyReqIDPolicy(p)
+		}
+		return o.ownsReqID(p.Tmpls[0].Reqid)
+	}
+
+	if p.Priority == o.vxlanBlockPriority() {
+		return p.Proto == netlink.Proto(syscall.IPPROTO_UDP)
+	}
+
+	if p.Priority != o.blockPriority() {
+		return false
+	}
+	return (p.Src != nil && o.isLocalSubnet(p.Src)) || (p.Dst != nil && o.isLocalSubnet(p.Dst))
+}
+
+func (o *Overlay) isLocalSubnet(n *net.IPNet) bool {
+	for _, subnet := range []string{o.db.LocalSubnet(), o.db.LocalSubnetV6()} {
+		if subnet != "" && n.String() == subnet {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package ipsec
+
+import (
+	"testing"
+)
+
+func TestNetworkID(t *testing.T) {
+	for _, name := range []string{"blue", "green", "red", "a", "a-much-longer-network-name"} {
+		id := NetworkID(name)
+		if id < 1 || id > MaxNetworkID {
+			t.Errorf("%s: ID %d out of 1..%d", name, id, MaxNetworkID)
+		}
+		if NetworkID(name) != id {
+			t.Errorf("%s: ID isn't stable", name)
+		}
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	tests := []struct {
+		network string
+		name    string
+		id      int
+		err     bool
+	}{
+		{network: "blue", name: "blue", id: NetworkID("blue")},
+		{network: "blue:7", name: "blue", id: 7},
+		{network: "blue:1", name: "blue", id: 1},
+		{network: "blue:255", name: "blue", id: MaxNetworkID},
+		{network: "", err: true},
+		{network: ":7", err: true},
+		{network: "blue:0", err: true},
+		{network: "blue:256", err: true},
+		{network: "blue:-1", err: true},
+		{network: "blue:seven", err: true},
+		{network: "blue:", err: true},
+		{network: "blue:7:8", err: true},
+	}
+
+	for _, test := range tests {
+		name, id, err := ParseNetwork(test.network)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.network)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.network, err)
+			continue
+		}
+		if name != test.name || id != test.id {
+			t.Errorf("%q: expected %s:%d, got %s:%d", test.network, test.name, test.id, name, id)
+		}
+	}
+}
+
+func TestAddNetworkSameID(t *testing.T) {
+	o, cleanup := newTestOverlay(t, testStore{})
+	defer cleanup()
+
+	if _, err := o.AddNetwork("blue", 7, o.db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.AddNetwork("green", 7, o.db); err == nil {
+		t.Error("expected an error for two networks with the same ID")
+	}
+}
+
+func TestPeerOverlay(t *testing.T) {
+	o, cleanup := newTestOverlay(t, testStore{})
+	defer cleanup()
+
+	blue, err := o.AddNetwork("blue", 7, o.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id      string
+		overlay *Overlay
+		host    string
+		err     bool
+	}{
+		{id: "10.0.0.2", overlay: o, host: "10.0.0.2"},
+		{id: "10.0.0.2@blue", overlay: blue, host: "10.0.0.2"},
+		{id: "10.0.0.2@green", err: true},
+	}
+
+	for _, test := range tests {
+		n, host, err := o.peerOverlay(test.id)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.id, err)
+			continue
+		}
+		if n != test.overlay || host != test.host {
+			t.Errorf("%s: expected network %q and host %s, got %q and %s", test.id, test.overlay.Network, test.host, n.Network, host)
+		}
+	}
+
+	for conn, network := range map[string]string{
+		o.connName("10.0.0.2"):    "",
+		blue.connName("10.0.0.2"): "blue",
+	} {
+		if got := o.connNetwork(conn); got != network {
+			t.Errorf("%s: expected network %q, got %q", conn, network, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ipsec
+
+import (
+	"fmt"
+
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/store"
+)
+
+// Name is the name the backend is registered under
+const Name = "ipsec"
+
+func init() {
+	backend.Register(Name, newBackend)
+}
+
+// Options are the settings of the backend, the modes, ports and number of
+// CHILD_SAs left empty keep the defaults of NewOverlay
+type Options struct {
+	ReplayWindowSize          string
+	IPSecIkeSaRekeyInterval   string
+	IPSecChildSaRekeyInterval string
+	Blacklist                 []string
+	Underlay                  string
+	EndpointSelection         string
+	Gateways                  bool
+	AllowedPeerGroups         map[string]bool
+	ChildSAs                  int
+	Mode                      string
+	VXLANPort                 int
+	VXLANNetworkPortBase      int
+
+	// Networks are the additional networks served besides the one of
+	// the agent
+	Networks []Network
+}
+
+// Network is an additional network with the store of its entries
+type Network struct {
+	Name string
+	ID   int
+	DB   store.Store
+}
+
+func newBackend(opts backend.Options) (backend.Backend, error) {
+	if opts.Metadata == nil {
+		return nil, fmt.Errorf("the %s backend needs metadata", Name)
+	}
+	config, ok := opts.Config.(Options)
+	if !ok && opts.Config != nil {
+		return nil, fmt.Errorf("invalid options for the %s backend: %T", Name, opts.Config)
+	}
+
+	o := NewOverlay(opts.ConfigDir, opts.DB, opts.Metadata)
+	o.StateDir = opts.StateDir
+	o.ReplayWindowSize = config.ReplayWindowSize
+	o.IPSecIkeSaRekeyInterval = config.IPSecIkeSaRekeyInterval
+	o.IPSecChildSaRekeyInterval = config.IPSecChildSaRekeyInterval
+	o.Blacklist = config.Blacklist
+	o.Gateways = config.Gateways
+	o.AllowedPeerGroups = config.AllowedPeerGroups
+	if config.Underlay != "" {
+		o.Underlay = config.Underlay
+	}
+	if config.EndpointSelection != "" {
+		o.EndpointSelection = config.EndpointSelection
+	}
+	if config.ChildSAs != 0 {
+		o.ChildSAs = config.ChildSAs
+	}
+	if config.Mode != "" {
+		o.Mode = config.Mode
+	}
+	if config.VXLANPort != 0 {
+		o.VXLANPort = config.VXLANPort
+	}
+	if config.VXLANNetworkPortBase != 0 {
+		o.VXLANNetworkPortBase = config.VXLANNetworkPortBase
+	}
+
+	for _, network := range config.Networks {
+		if _, err := o.AddNetwork(network.Name, network.ID, network.DB); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
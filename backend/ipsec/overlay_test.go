@@ -0,0 +1,43 @@
+package ipsec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/rancher/ipsec/store"
+)
+
+// testStore is the content of the file of the store of a test overlay
+type testStore struct {
+	Self          store.Entry   `json:"self"`
+	Entries       []store.Entry `json:"entries"`
+	LocalSubnet   string        `json:"localSubnet"`
+	LocalSubnetV6 string        `json:"localSubnetV6,omitempty"`
+}
+
+// newTestOverlay returns an overlay reading its entries from a file
+// holding data, and a function removing the file
+func newTestOverlay(t *testing.T, data testStore) (*Overlay, func()) {
+	dir, err := ioutil.TempDir("", "ipsec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := json.Marshal(data)
+	if err == nil {
+		err = ioutil.WriteFile(path.Join(dir, "store.json"), content, 0600)
+	}
+	db := store.NewFileStore(path.Join(dir, "store.json"))
+	if err == nil {
+		err = db.Reload()
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return NewOverlay(dir, db, nil), func() { os.RemoveAll(dir) }
+}
@@ -0,0 +1,110 @@
+package ipsec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rancher/ipsec/store"
+)
+
+// sitesDir holds a directory for every environment, or region, linked to
+// the local one which uses its own credentials. Each of them contains the
+// psk.txt shared by the hosts of the local and the linked environment and
+// optionally the ike.conf and childsa.conf templates used with the hosts of
+// the linked environment instead of the local ones.
+const sitesDir = "sites"
+
+// site holds the credentials and templates for the hosts of an
+// environment or region
+type site struct {
+	psk       string
+	templates *Templates
+}
+
+// loadSites reads the credentials and templates of the linked sites
+func (o *Overlay) loadSites() error {
+	sites := map[string]site{}
+
+	dir := path.Join(o.templates.ConfigDir, sitesDir)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		o.sites = sites
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+
+		name := file.Name()
+		content, err := ioutil.ReadFile(path.Join(dir, name, pskFile))
+		if err != nil {
+			return fmt.Errorf("failed to read key of site %s: %v", name, err)
+		}
+
+		templates := &Templates{
+			ConfigDir: path.Join(dir, name),
+			base:      &o.templates,
+		}
+		if err := templates.Reload(); err != nil {
+			return fmt.Errorf("failed to load templates of site %s: %v", name, err)
+		}
+
+		sites[name] = site{
+			psk:       strings.TrimSpace(string(content)),
+			templates: templates,
+		}
+	}
+
+	o.sites = sites
+	return nil
+}
+
+// siteFor returns the site of the host of the entry, looked up by
+// environment then by region. Hosts of the local environment, and of the
+// sites without a directory, use the local credentials.
+func (o *Overlay) siteFor(entry store.Entry) (site, bool) {
+	local := o.db.LocalEntry()
+	if entry.HostEnvironment == local.HostEnvironment {
+		return site{}, false
+	}
+	if s, ok := o.sites[entry.HostEnvironment]; ok {
+		return s, true
+	}
+	if entry.HostRegion != local.HostRegion {
+		if s, ok := o.sites[entry.HostRegion]; ok {
+			return s, true
+		}
+	}
+	return site{}, false
+}
+
+func (o *Overlay) getPsk(entry store.Entry) string {
+	if s, ok := o.siteFor(entry); ok {
+		return s.psk
+	}
+	return o.psk
+}
+
+func (o *Overlay) templatesFor(entry store.Entry) *Templates {
+	if s, ok := o.siteFor(entry); ok {
+		return s.templates
+	}
+	return &o.templates
+}
+
+func (o *Overlay) siteNames() []string {
+	names := []string{}
+	for name := range o.sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,297 @@
+package ipsec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bronze1man/goStrongswanVici"
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+)
+
+const (
+	backendName    = "ipsec"
+	ikeEstablished = "ESTABLISHED"
+	childInstalled = "INSTALLED"
+)
+
+// Status returns a summary of the state of the overlay
+func (o *Overlay) Status() (backend.Status, error) {
+	peers, err := o.Peers()
+	if err != nil {
+		return backend.Status{}, err
+	}
+
+	policies, err := o.Policies()
+	if err != nil {
+		return backend.Status{}, err
+	}
+
+	status := backend.Status{
+		Backend:     backendName,
+		LocalHost:   o.db.LocalHostIPAddress(),
+		LocalSubnet: o.db.LocalSubnet(),
+		Peers:       len(peers),
+		Policies:    len(policies),
+	}
+	for _, peer := range peers {
+		if peer.State == ikeEstablished {
+			status.EstablishedPeers++
+		}
+	}
+
+	return status, nil
+}
+
+// Peers returns the state of the connections to the remote hosts, of the
+// additional networks too. The hosts outside the allowed peer groups and
+// the ones reached through a gateway are left out.
+func (o *Overlay) Peers() ([]backend.Peer, error) {
+	sas, err := listSas()
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]string{}
+	for _, conns := range sas {
+		for name, sa := range conns {
+			states[name] = sa.State
+		}
+	}
+
+	peers := o.peers(states)
+	for _, n := range o.networks {
+		peers = append(peers, n.peers(states)...)
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Network != peers[j].Network {
+			return peers[i].Network < peers[j].Network
+		}
+		return peers[i].Host < peers[j].Host
+	})
+	return peers, nil
+}
+
+// peers returns the state of the connections of the overlay, given the
+// states of the IKE_SAs by connection
+func (o *Overlay) peers(states map[string]string) []backend.Peer {
+	o.Lock()
+	entries := o.peerEntries()
+	loaded := map[string]bool{}
+	for host := range o.hosts {
+		loaded[host] = true
+		if _, ok := entries[host]; !ok {
+			entries[host] = 0
+		}
+	}
+	o.Unlock()
+
+	peers := []backend.Peer{}
+	for host, count := range entries {
+		name := o.connName(host)
+		iface, bytesIn, bytesOut := o.interfaceStats(host)
+		peers = append(peers, backend.Peer{
+			Host:       host,
+			Connection: name,
+			Loaded:     loaded[host],
+			Network:    o.Network,
+			State:      states[name],
+			Entries:    count,
+			Interface:  iface,
+			BytesIn:    bytesIn,
+			BytesOut:   bytesOut,
+		})
+	}
+	return peers
+}
+
+// peerEntries counts the remote entries by the host their traffic is
+// tunneled to, the local gateway or the one of their site when they are
+// reached through the gateways
+func (o *Overlay) peerEntries() map[string]int {
+	localHostIP := o.db.LocalHostIPAddress()
+	gateways := o.siteGateways()
+	entries := map[string]int{}
+	for _, entry := range o.db.Entries() {
+		if entry.HostIPAddress != localHostIP && o.peerAllowed(entry) {
+			entries[o.nextHop(entry, gateways).HostIPAddress]++
+		}
+	}
+	return entries
+}
+
+// SAs returns the CHILD_SAs currently known to charon, with the network
+// of the connection they belong to
+func (o *Overlay) SAs() ([]backend.SA, error) {
+	sas, err := listSas()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []backend.SA{}
+	for _, conns := range sas {
+		for conn, ikeSA := range conns {
+			network := o.connNetwork(conn)
+			for name, childSA := range ikeSA.Child_sas {
+				ret = append(ret, backend.SA{
+					Name:     name,
+					Host:     ikeSA.Remote_host,
+					State:    childSA.State,
+					ReqID:    childSA.Reqid,
+					Mode:     childSA.Mode,
+					SPIIn:    childSA.Spi_in,
+					SPIOut:   childSA.Spi_out,
+					BytesIn:  childSA.GetBytesIn(),
+					BytesOut: childSA.GetBytesOut(),
+					LocalTS:  childSA.Local_ts,
+					RemoteTS: childSA.Remote_ts,
+					Network:  network,
+				})
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// connNetwork returns the additional network the connection belongs to,
+// empty for the ones of the agent network
+func (o *Overlay) connNetwork(conn string) string {
+	for _, n := range o.networks {
+		if strings.HasPrefix(conn, n.connName("")) {
+			return n.Network
+		}
+	}
+	return ""
+}
+
+// Policies returns the xfrm policies tunneling the traffic of the overlay
+// and of the additional networks
+func (o *Overlay) Policies() ([]backend.Policy, error) {
+	ret, err := o.policies()
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range o.networks {
+		policies, err := n.policies()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, policies...)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Network != ret[j].Network {
+			return ret[i].Network < ret[j].Network
+		}
+		if ret[i].Dst != ret[j].Dst {
+			return ret[i].Dst < ret[j].Dst
+		}
+		return ret[i].Dir < ret[j].Dir
+	})
+	return ret, nil
+}
+
+// policies returns the xfrm policies set up by the overlay alone
+func (o *Overlay) policies() ([]backend.Policy, error) {
+	policies, err := o.getRules()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []backend.Policy{}
+	for _, policy := range policies {
+		if len(policy.Tmpls) == 0 || !o.ownsPolicy(&policy) {
+			continue
+		}
+		p := xfrm.ToPolicy(policy)
+		p.Network = o.Network
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// peerOverlay returns the overlay of the network of the peer ID, with the
+// host of the peer
+func (o *Overlay) peerOverlay(id string) (*Overlay, string, error) {
+	host, network := backend.ParsePeerID(id)
+	if network == "" {
+		return o, host, nil
+	}
+	for _, n := range o.networks {
+		if n.Network == network {
+			return n, host, nil
+		}
+	}
+	return nil, "", fmt.Errorf("unknown network %s", network)
+}
+
+// InitiatePeer brings up the tunnel to the given host, host@network for
+// the hosts of an additional network
+func (o *Overlay) InitiatePeer(id string) error {
+	n, host, err := o.peerOverlay(id)
+	if err != nil {
+		return err
+	}
+	if err := n.checkPeer(host); err != nil {
+		return err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for k := 0; k < n.childSAs(); k++ {
+		if err := client.Initiate(n.childSAName(host, k), n.connName(host)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TerminatePeer tears down the tunnel to the given host, host@network for
+// the hosts of an additional network. Unless the connection is removed,
+// charon brings the tunnel back up on its own.
+func (o *Overlay) TerminatePeer(id string) error {
+	n, host, err := o.peerOverlay(id)
+	if err != nil {
+		return err
+	}
+	if err := n.checkPeer(host); err != nil {
+		return err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Terminate(&goStrongswanVici.TerminateRequest{
+		Ike: n.connName(host),
+	})
+}
+
+func (o *Overlay) checkPeer(host string) error {
+	o.Lock()
+	defer o.Unlock()
+
+	if _, ok := o.hosts[host]; !ok {
+		return fmt.Errorf("no connection loaded for host %s", host)
+	}
+	return nil
+}
+
+func listSas() ([]map[string]goStrongswanVici.IkeSa, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.ListSas("", "")
+}
@@ -15,6 +15,8 @@ import (
 const (
 	ikeConfName     = "ike.conf"
 	childSaConfName = "childsa.conf"
+
+	defaultSource = "default"
 )
 
 var (
@@ -33,8 +35,8 @@ var (
 		}
 	}`)
 	defaultChildSaConf = []byte(`{
-		"local_ts": ["0.0.0.0/0"],
-		"remote_ts": ["0.0.0.0/0"],
+		"local_ts": ["0.0.0.0/0", "::/0"],
+		"remote_ts": ["0.0.0.0/0", "::/0"],
 		"esp_proposals":  ["aes128gcm16-modp2048", "aes-modp2048"],
 		"start_action": "start",
 		"close_action": "start",
@@ -48,14 +50,27 @@ var (
 type Templates struct {
 	ConfigDir           string
 	ikeConfTemplate     []byte
+	ikeConfSource       string
 	childSaConfTemplate []byte
+	childSaConfSource   string
 	revision            string
+
+	// base provides the templates missing from ConfigDir, instead of
+	// the built-in ones
+	base *Templates
 }
 
 // Reload is used to refresh the templates
 func (t *Templates) Reload() error {
 	var err error
-	t.ikeConfTemplate, err = t.loadBytes(ikeConfName, defaultIkeConf)
+	ikeConfDefault, ikeConfDefaultSource := defaultIkeConf, defaultSource
+	childSaConfDefault, childSaConfDefaultSource := defaultChildSaConf, defaultSource
+	if t.base != nil {
+		ikeConfDefault, ikeConfDefaultSource = t.base.ikeConfTemplate, t.base.ikeConfSource
+		childSaConfDefault, childSaConfDefaultSource = t.base.childSaConfTemplate, t.base.childSaConfSource
+	}
+
+	t.ikeConfTemplate, t.ikeConfSource, err = t.loadBytes(ikeConfName, ikeConfDefault, ikeConfDefaultSource)
 	if err != nil {
 		return err
 	}
@@ -64,7 +79,7 @@ func (t *Templates) Reload() error {
 		return err
 	}
 
-	t.childSaConfTemplate, err = t.loadBytes(childSaConfName, defaultChildSaConf)
+	t.childSaConfTemplate, t.childSaConfSource, err = t.loadBytes(childSaConfName, childSaConfDefault, childSaConfDefaultSource)
 	if err != nil {
 		return err
 	}
@@ -86,6 +101,18 @@ func (t *Templates) Revision() string {
 	return t.revision
 }
 
+// IkeConfSource returns the file the IKE config template was loaded
+// from, or "default" if the built-in template is used
+func (t *Templates) IkeConfSource() string {
+	return t.ikeConfSource
+}
+
+// ChildSaConfSource returns the file the CHILD_SA config template was
+// loaded from, or "default" if the built-in template is used
+func (t *Templates) ChildSaConfSource() string {
+	return t.childSaConfSource
+}
+
 // NewIkeConf returns IKE config from the template
 func (t *Templates) NewIkeConf() goStrongswanVici.IKEConf {
 	var resp goStrongswanVici.IKEConf
@@ -102,10 +129,11 @@ func (t *Templates) NewChildSaConf() goStrongswanVici.ChildSAConf {
 	return resp
 }
 
-func (t *Templates) loadBytes(file string, defaultBytes []byte) ([]byte, error) {
-	bytes, err := ioutil.ReadFile(path.Join(t.ConfigDir, file))
+func (t *Templates) loadBytes(file string, defaultBytes []byte, source string) ([]byte, string, error) {
+	file = path.Join(t.ConfigDir, file)
+	bytes, err := ioutil.ReadFile(file)
 	if os.IsNotExist(err) {
-		return defaultBytes, nil
+		return defaultBytes, source, nil
 	}
-	return bytes, err
+	return bytes, file, err
 }
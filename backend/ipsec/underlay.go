@@ -0,0 +1,94 @@
+package ipsec
+
+import (
+	"net"
+
+	"github.com/rancher/ipsec/store"
+)
+
+// Address families the tunnels between hosts can run over
+const (
+	UnderlayAuto = "auto"
+	UnderlayIPv4 = "ipv4"
+	UnderlayIPv6 = "ipv6"
+)
+
+// Rules choosing between the private and public endpoints of a host
+const (
+	EndpointByRegion      = "region"
+	EndpointByEnvironment = "environment"
+)
+
+// hostAddrs returns the IPv4 and IPv6 addresses of a host, either of them
+// empty when the host doesn't have one
+func hostAddrs(hostIP, hostIPv6 string) (string, string) {
+	v4, v6 := "", hostIPv6
+	if ip := net.ParseIP(hostIP); ip != nil {
+		if ip.To4() != nil {
+			v4 = hostIP
+		} else if v6 == "" {
+			v6 = hostIP
+		}
+	}
+	return v4, v6
+}
+
+// remoteEndpoint picks the address of the host of the entry the tunnel
+// runs to. The family preferred by Underlay, or the one of the local agent
+// IP in UnderlayAuto, is used when both hosts have an address of it and
+// the other one otherwise, so a peer reachable only over IPv6 still gets a
+// tunnel when IPv4 is preferred.
+func (o *Overlay) remoteEndpoint(entry store.Entry) string {
+	if endpoint := o.labeledEndpoint(entry); endpoint != "" {
+		return endpoint
+	}
+
+	localV4, localV6 := hostAddrs(o.db.LocalHostIPAddress(), o.db.LocalHostIPv6Address())
+	remoteV4, remoteV6 := hostAddrs(entry.HostIPAddress, entry.HostIPv6Address)
+
+	v4 := ""
+	if localV4 != "" {
+		v4 = remoteV4
+	}
+	v6 := ""
+	if localV6 != "" {
+		v6 = remoteV6
+	}
+
+	preferV6 := o.Underlay == UnderlayIPv6
+	if o.Underlay == UnderlayAuto {
+		preferV6 = localV4 == ""
+	}
+
+	switch {
+	case preferV6 && v6 != "":
+		return v6
+	case v4 != "":
+		return v4
+	case v6 != "":
+		return v6
+	}
+	return entry.HostIPAddress
+}
+
+// localEndpoint returns the local address of the tunnel to remote
+func (o *Overlay) localEndpoint(remote string) string {
+	if ip := net.ParseIP(remote); ip != nil && ip.To4() == nil {
+		if local := o.db.LocalIPv6Address(); local != "" {
+			return local
+		}
+		_, localV6 := hostAddrs(o.db.LocalHostIPAddress(), o.db.LocalHostIPv6Address())
+		return localV6
+	}
+	return o.db.LocalIPAddress()
+}
+
+// labeledEndpoint returns the endpoint set through the labels of the host
+// of the entry: the private one for the peers in the same region, or
+// environment with EndpointByEnvironment, and the public one for the others
+func (o *Overlay) labeledEndpoint(entry store.Entry) string {
+	if o.site(entry) == o.site(o.db.LocalEntry()) {
+		return entry.PrivateEndpoint
+	}
+	return entry.PublicEndpoint
+}
@@ -0,0 +1,254 @@
+package ipsec
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bronze1man/goStrongswanVici"
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/log"
+)
+
+const (
+	ikeUpdownEvent   = "ike-updown"
+	childUpdownEvent = "child-updown"
+
+	// watchProbeInterval is how often the connection receiving the
+	// events from charon is checked, watchRetryInterval how long to
+	// wait before setting it up again
+	watchProbeInterval = 10 * time.Second
+	watchRetryInterval = 5 * time.Second
+)
+
+// saTracker follows the CHILD_SAs installed by connection, a peer is up
+// as long as its connection has one. The CHILD_SAs are told apart by the
+// unique ID of their IKE_SA and their name.
+type saTracker struct {
+	sync.Mutex
+	sas map[string]map[string]bool
+}
+
+func newSATracker() *saTracker {
+	return &saTracker{
+		sas: map[string]map[string]bool{},
+	}
+}
+
+// up tells whether the connection has a CHILD_SA installed
+func (t *saTracker) up(conn string) bool {
+	return len(t.sas[conn]) > 0
+}
+
+// child records a CHILD_SA of the connection installed or deleted and
+// tells whether the connection went up or down
+func (t *saTracker) child(conn, ike, child string, installed bool) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	before := t.up(conn)
+	key := ike + "/" + child
+	if installed {
+		if t.sas[conn] == nil {
+			t.sas[conn] = map[string]bool{}
+		}
+		t.sas[conn][key] = true
+	} else {
+		delete(t.sas[conn], key)
+	}
+	return before != t.up(conn)
+}
+
+// ikeDown drops the CHILD_SAs of a deleted IKE_SA of the connection and
+// tells whether the connection went down
+func (t *saTracker) ikeDown(conn, ike string) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	before := t.up(conn)
+	for key := range t.sas[conn] {
+		if strings.HasPrefix(key, ike+"/") {
+			delete(t.sas[conn], key)
+		}
+	}
+	return before != t.up(conn)
+}
+
+// ikeUpdown handles an ike-updown event. The IKE_SA going up doesn't
+// bring the peer up yet, a CHILD_SA has to be installed.
+func (t *saTracker) ikeUpdown(msg map[string]interface{}, report func(conn string, up bool)) {
+	if _, up := msg["up"]; up {
+		return
+	}
+	for conn, ikeSA := range updownSAs(msg) {
+		if t.ikeDown(conn, saString(ikeSA, "uniqueid")) {
+			report(conn, false)
+		}
+	}
+}
+
+// childUpdown handles a child-updown event
+func (t *saTracker) childUpdown(msg map[string]interface{}, report func(conn string, up bool)) {
+	_, up := msg["up"]
+	for conn, ikeSA := range updownSAs(msg) {
+		children, _ := ikeSA["child-sas"].(map[string]interface{})
+		for child := range children {
+			if t.child(conn, saString(ikeSA, "uniqueid"), child, up) {
+				report(conn, up)
+			}
+		}
+	}
+}
+
+// reset replaces the CHILD_SAs with the ones listed by charon and returns
+// the connections which went up or down meanwhile
+func (t *saTracker) reset(sas []map[string]goStrongswanVici.IkeSa) map[string]bool {
+	installed := map[string]map[string]bool{}
+	for _, conns := range sas {
+		for conn, ikeSA := range conns {
+			for name, childSA := range ikeSA.Child_sas {
+				if childSA.State != childInstalled {
+					continue
+				}
+				if installed[conn] == nil {
+					installed[conn] = map[string]bool{}
+				}
+				installed[conn][ikeSA.Uniqueid+"/"+name] = true
+			}
+		}
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	changed := map[string]bool{}
+	for conn := range t.sas {
+		if t.up(conn) && len(installed[conn]) == 0 {
+			changed[conn] = false
+		}
+	}
+	for conn := range installed {
+		if !t.up(conn) {
+			changed[conn] = true
+		}
+	}
+	t.sas = installed
+	return changed
+}
+
+// WatchPeers reports the peers of the overlay and of the additional
+// networks going up and down, from the ike-updown and child-updown events
+// of charon. The connection receiving them is set up again when lost,
+// the changes missed meanwhile are reported from the SAs listed then.
+func (o *Overlay) WatchPeers(stop <-chan struct{}, updown func(id string, up bool)) error {
+	go o.watchPeers(stop, updown)
+	return nil
+}
+
+func (o *Overlay) watchPeers(stop <-chan struct{}, updown func(id string, up bool)) {
+	tracker := newSATracker()
+	report := func(conn string, up bool) {
+		if id, ok := o.connPeerID(conn); ok {
+			updown(id, up)
+		}
+	}
+
+	seeded := false
+	for {
+		client, err := o.watchEvents(tracker, report)
+		if err != nil {
+			log.Errorf("Failed to watch the peers: %v", err)
+		} else {
+			// The SAs of the first listing are the initial state,
+			// the later ones catch up with the events missed while
+			// reconnecting
+			sas, listErr := listSas()
+			if listErr != nil {
+				log.Errorf("Failed to list the SAs of the peers: %v", listErr)
+			} else {
+				for conn, up := range tracker.reset(sas) {
+					if seeded {
+						report(conn, up)
+					}
+				}
+				seeded = true
+			}
+
+			for err == nil {
+				select {
+				case <-stop:
+					client.Close()
+					return
+				case <-time.After(watchProbeInterval):
+				}
+				_, err = client.Version()
+			}
+			log.Infof("Lost the connection watching the peers: %v", err)
+			client.Close()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// watchEvents connects to charon and registers for the events of the
+// IKE_SAs and CHILD_SAs going up and down
+func (o *Overlay) watchEvents(tracker *saTracker, report func(conn string, up bool)) (*goStrongswanVici.ClientConn, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.RegisterEvent(ikeUpdownEvent, func(msg map[string]interface{}) {
+		tracker.ikeUpdown(msg, report)
+	})
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	err = client.RegisterEvent(childUpdownEvent, func(msg map[string]interface{}) {
+		tracker.childUpdown(msg, report)
+	})
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// updownSAs returns the IKE_SAs of an updown event by connection, the
+// other keys of the event aren't sections
+func updownSAs(msg map[string]interface{}) map[string]map[string]interface{} {
+	sas := map[string]map[string]interface{}{}
+	for conn, value := range msg {
+		if ikeSA, ok := value.(map[string]interface{}); ok {
+			sas[conn] = ikeSA
+		}
+	}
+	return sas
+}
+
+func saString(sa map[string]interface{}, key string) string {
+	value, _ := sa[key].(string)
+	return value
+}
+
+// connPeerID returns the PeerID of the peer of a connection of the
+// overlay or of an additional network, false for any other connection
+func (o *Overlay) connPeerID(conn string) (string, bool) {
+	for _, n := range o.networks {
+		if prefix := n.connName(""); strings.HasPrefix(conn, prefix) {
+			return backend.PeerID(strings.TrimPrefix(conn, prefix), n.Network), true
+		}
+	}
+	if prefix := o.connName(""); strings.HasPrefix(conn, prefix) {
+		return backend.PeerID(strings.TrimPrefix(conn, prefix), ""), true
+	}
+	return "", false
+}
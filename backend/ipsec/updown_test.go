@@ -0,0 +1,185 @@
+package ipsec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bronze1man/goStrongswanVici"
+)
+
+// updownEvent builds an ike-updown or child-updown event of the IKE_SA
+// with the unique ID, with the given CHILD_SAs
+func updownEvent(up bool, conn, ike string, children ...string) map[string]interface{} {
+	ikeSA := map[string]interface{}{
+		"uniqueid": ike,
+		"state":    ikeEstablished,
+	}
+	if len(children) > 0 {
+		childSAs := map[string]interface{}{}
+		for _, child := range children {
+			childSAs[child] = map[string]interface{}{"state": childInstalled}
+		}
+		ikeSA["child-sas"] = childSAs
+	}
+
+	msg := map[string]interface{}{conn: ikeSA}
+	if up {
+		msg["up"] = "yes"
+	}
+	return msg
+}
+
+func TestSATracker(t *testing.T) {
+	type report struct {
+		conn string
+		up   bool
+	}
+	type event struct {
+		child bool
+		msg   map[string]interface{}
+	}
+
+	tests := []struct {
+		name    string
+		events  []event
+		reports []report
+	}{
+		{
+			name: "up and down",
+			events: []event{
+				{msg: updownEvent(true, "conn-a", "1")},
+				{child: true, msg: updownEvent(true, "conn-a", "1", "child-a-1")},
+				{child: true, msg: updownEvent(false, "conn-a", "1", "child-a-1")},
+				{msg: updownEvent(false, "conn-a", "1")},
+			},
+			reports: []report{{"conn-a", true}, {"conn-a", false}},
+		},
+		{
+			name: "IKE_SA deleted with its CHILD_SAs",
+			events: []event{
+				{child: true, msg: updownEvent(true, "conn-a", "1", "child-a-1")},
+				{child: true, msg: updownEvent(true, "conn-a", "1", "child-a-2")},
+				{msg: updownEvent(false, "conn-a", "1")},
+			},
+			reports: []report{{"conn-a", true}, {"conn-a", false}},
+		},
+		{
+			name: "reauthenticated before the old IKE_SA is deleted",
+			events: []event{
+				{child: true, msg: updownEvent(true, "conn-a", "1", "child-a-1")},
+				{child: true, msg: updownEvent(true, "conn-a", "2", "child-a-3")},
+				{msg: updownEvent(false, "conn-a", "1")},
+			},
+			reports: []report{{"conn-a", true}},
+		},
+		{
+			name: "one of several CHILD_SAs deleted",
+			events: []event{
+				{child: true, msg: updownEvent(true, "conn-a", "1", "child-a-1")},
+				{child: true, msg: updownEvent(true, "conn-a", "1", "child-a-2")},
+				{child: true, msg: updownEvent(false, "conn-a", "1", "child-a-1")},
+			},
+			reports: []report{{"conn-a", true}},
+		},
+		{
+			name: "connections apart",
+			events: []event{
+				{child: true, msg: updownEvent(true, "conn-a", "1", "child-a-1")},
+				{child: true, msg: updownEvent(true, "conn-b", "2", "child-b-2")},
+				{msg: updownEvent(false, "conn-b", "2")},
+			},
+			reports: []report{{"conn-a", true}, {"conn-b", true}, {"conn-b", false}},
+		},
+	}
+
+	for _, test := range tests {
+		tracker := newSATracker()
+		reports := []report{}
+		for _, e := range test.events {
+			record := func(conn string, up bool) {
+				reports = append(reports, report{conn, up})
+			}
+			if e.child {
+				tracker.childUpdown(e.msg, record)
+			} else {
+				tracker.ikeUpdown(e.msg, record)
+			}
+		}
+		if !reflect.DeepEqual(reports, test.reports) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.reports, reports)
+		}
+	}
+}
+
+func TestSATrackerReset(t *testing.T) {
+	tracker := newSATracker()
+	tracker.child("conn-a", "1", "child-a-1", true)
+	tracker.child("conn-b", "2", "child-b-2", true)
+
+	// While disconnected, conn-a went down and conn-c up, conn-b
+	// reauthenticated
+	changed := tracker.reset([]map[string]goStrongswanVici.IkeSa{
+		{
+			"conn-b": {
+				Uniqueid: "3",
+				Child_sas: map[string]goStrongswanVici.Child_sas{
+					"child-b-3": {State: childInstalled},
+				},
+			},
+		},
+		{
+			"conn-c": {
+				Uniqueid: "4",
+				Child_sas: map[string]goStrongswanVici.Child_sas{
+					"child-c-4": {State: childInstalled},
+				},
+			},
+		},
+		{
+			"conn-d": {
+				Uniqueid: "5",
+				Child_sas: map[string]goStrongswanVici.Child_sas{
+					"child-d-5": {State: "INSTALLING"},
+				},
+			},
+		},
+	})
+
+	expected := map[string]bool{"conn-a": false, "conn-c": true}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected %v, got %v", expected, changed)
+	}
+
+	// The events go on from the listed SAs
+	if !tracker.ikeDown("conn-b", "3") {
+		t.Error("expected conn-b to go down with its listed IKE_SA")
+	}
+}
+
+func TestConnPeerID(t *testing.T) {
+	o, cleanup := newTestOverlay(t, testStore{})
+	defer cleanup()
+
+	blue, err := o.AddNetwork("blue", 7, o.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		conn string
+		id   string
+		ok   bool
+	}{
+		{conn: o.connName("10.0.0.2"), id: "10.0.0.2", ok: true},
+		{conn: blue.connName("10.0.0.2"), id: "10.0.0.2@blue", ok: true},
+		{conn: "green-conn-10.0.0.2", ok: false},
+		{conn: "other", ok: false},
+	}
+
+	for _, test := range tests {
+		id, ok := o.connPeerID(test.conn)
+		if id != test.id || ok != test.ok {
+			t.Errorf("%s: expected %q, %v, got %q, %v", test.conn, test.id, test.ok, id, ok)
+		}
+	}
+}
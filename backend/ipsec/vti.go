@@ -0,0 +1,319 @@
+package ipsec
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+	"github.com/vishvananda/netlink"
+)
+
+// Data plane modes of the overlay
+const (
+	// ModePolicy installs xfrm policies for every remote container IP
+	ModePolicy = "policy"
+
+	// ModeInterface creates a VTI interface for every peer, with
+	// policies for any traffic marked with its key, and routes the
+	// remote container IPs through them
+	ModeInterface = "interface"
+)
+
+// vtiAliasPrefix marks the interfaces managed by the overlay
+const vtiAliasPrefix = "rancher-ipsec"
+
+var (
+	anyNetV4 = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	anyNetV6 = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+)
+
+// vtiKey returns the key marking the traffic of the interface to the
+// host, which is also the mark of its SAs and policies and the end of the
+// MAC address of its VXLAN interface. Its top byte is the ID of the
+// network, so the keys of the networks never collide.
+func (o *Overlay) vtiKey(host string) uint32 {
+	if key, ok := o.vtiKeys[host]; ok {
+		return key
+	}
+	return o.mark() | o.vtiHash(host)
+}
+
+// vtiHash returns the key of the host without the bits of the network,
+// never 0
+func (o *Overlay) vtiHash(host string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(o.Network + "/" + host))
+	if key := h.Sum32() &^ networkMarkMask; key != 0 {
+		return key
+	}
+	return 1
+}
+
+// assignVTIKeys gives a key to every host of the store. The hosts whose
+// hashes collide are taken in order, the first one keeps its hash and the
+// next ones get the following free keys. All the hosts see the same hosts
+// so they agree on the keys, and the MAC addresses derived from them. The
+// caller holds the lock.
+func (o *Overlay) assignVTIKeys() {
+	hosts := []string{}
+	seen := map[string]bool{}
+	for _, entry := range o.db.Entries() {
+		if entry.HostIPAddress != "" && !seen[entry.HostIPAddress] {
+			seen[entry.HostIPAddress] = true
+			hosts = append(hosts, entry.HostIPAddress)
+		}
+	}
+	sort.Strings(hosts)
+
+	keys := map[string]uint32{}
+	used := map[uint32]string{}
+	for _, host := range hosts {
+		key := o.vtiHash(host)
+		for used[key] != "" {
+			key = key%(^uint32(networkMarkMask)) + 1
+		}
+		if key != o.vtiHash(host) {
+			log.Infof("Key of host %s collides with the one of host %s, using %08x", host, used[o.vtiHash(host)], o.mark()|key)
+		}
+		used[key] = host
+		keys[host] = o.mark() | key
+	}
+	o.vtiKeys = keys
+}
+
+func (o *Overlay) vtiName(host string) string {
+	return fmt.Sprintf("ipsec%08x", o.vtiKey(host))
+}
+
+func (o *Overlay) vtiAlias(host string) string {
+	return fmt.Sprintf("%s:%s:%s", vtiAliasPrefix, o.Network, host)
+}
+
+// vtiHost returns the host of an interface managed by the overlay
+func (o *Overlay) vtiHost(link netlink.Link) (string, bool) {
+	prefix := o.vtiAlias("")
+	alias := link.Attrs().Alias
+	if !strings.HasPrefix(alias, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(alias, prefix), true
+}
+
+// addInterface sets up the interface to the host of hop and the policies
+// tying it to the tunnel
+func (o *Overlay) addInterface(hop store.Entry, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
+	remoteEndpoint := o.remoteEndpoint(hop)
+	localIP := net.ParseIP(o.localEndpoint(remoteEndpoint))
+	remoteHostIP := net.ParseIP(remoteEndpoint)
+	key := o.vtiKey(hop.HostIPAddress)
+
+	if err := o.ensureVTI(hop.HostIPAddress, localIP, remoteHostIP, key); err != nil {
+		return err
+	}
+
+	mark := &netlink.XfrmMark{Value: key, Mask: 0xffffffff}
+	for _, anyNet := range []*net.IPNet{anyNetV4, anyNetV6} {
+		policies := []netlink.XfrmPolicy{
+			{
+				Src:      anyNet,
+				Dst:      anyNet,
+				Dir:      netlink.XFRM_DIR_OUT,
+				Priority: 10000,
+				Mark:     mark,
+				Tmpls: []netlink.XfrmPolicyTmpl{
+					{
+						Src:   localIP,
+						Dst:   remoteHostIP,
+						Proto: netlink.XFRM_PROTO_ESP,
+						Mode:  netlink.XFRM_MODE_TUNNEL,
+						Reqid: o.ReqID,
+					},
+				},
+			},
+		}
+		for _, dir := range []netlink.Dir{netlink.XFRM_DIR_IN, netlink.XFRM_DIR_FWD} {
+			policies = append(policies, netlink.XfrmPolicy{
+				Src:      anyNet,
+				Dst:      anyNet,
+				Dir:      dir,
+				Priority: 10000,
+				Mark:     mark,
+				Tmpls: []netlink.XfrmPolicyTmpl{
+					{
+						Src:   remoteHostIP,
+						Dst:   localIP,
+						Proto: netlink.XFRM_PROTO_ESP,
+						Mode:  netlink.XFRM_MODE_TUNNEL,
+						Reqid: o.ReqID,
+					},
+				},
+			})
+		}
+
+		for _, policy := range policies {
+			xfrm.Want(policy, existingPolicies, policiesToAdd)
+		}
+	}
+
+	return nil
+}
+
+// ensureVTI creates the interface to the host, replacing the existing one
+// if its tunnel endpoints changed
+func (o *Overlay) ensureVTI(host string, localIP, remoteIP net.IP, key uint32) error {
+	name := o.vtiName(host)
+	if link, err := netlink.LinkByName(name); err == nil {
+		vti, ok := link.(*netlink.Vti)
+		if ok && vti.Local.Equal(localIP) && vti.Remote.Equal(remoteIP) && vti.IKey == key {
+			return netlink.LinkSetUp(link)
+		}
+		log.Infof("Replacing interface %s to %s", name, host)
+		if err := netlink.LinkDel(link); err != nil {
+			return err
+		}
+	}
+
+	vti := &netlink.Vti{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: name,
+		},
+		IKey:   key,
+		OKey:   key,
+		Local:  localIP,
+		Remote: remoteIP,
+	}
+	if err := netlink.LinkAdd(vti); err != nil {
+		return err
+	}
+	if err := netlink.LinkSetAlias(vti, o.vtiAlias(host)); err != nil {
+		return err
+	}
+
+	// The policies of the interface check the decrypted traffic already
+	if localIP.To4() != nil {
+		if err := ioutil.WriteFile(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/disable_policy", name), []byte("1"), 0644); err != nil {
+			log.Errorf("Failed to disable policy checks on %s: %v", name, err)
+		}
+	}
+
+	log.Infof("Added interface %s to %s", name, host)
+	return netlink.LinkSetUp(vti)
+}
+
+// syncInterfaces routes the remote container IPs through the interface of
+// their next hop and removes the routes and interfaces no longer used
+func (o *Overlay) syncInterfaces(routes map[string]string) error {
+	var firstErr error
+
+	links, err := netlink.LinkList()
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]map[string]bool{}
+	for ip, host := range routes {
+		if wanted[host] == nil {
+			wanted[host] = map[string]bool{}
+		}
+		wanted[host][ip] = true
+	}
+
+	for _, link := range links {
+		host, ok := o.vtiHost(link)
+		if !ok {
+			continue
+		}
+
+		// The interface of a host whose key moved off a collision is
+		// replaced by one named after the new key
+		ips, ok := wanted[host]
+		if !ok || link.Attrs().Name != o.vtiName(host) {
+			log.Infof("Removing interface %s to %s", link.Attrs().Name, host)
+			if err := netlink.LinkDel(link); err != nil {
+				firstErr = backend.HandleErr(firstErr, err, "Failed to remove interface %s: %v", link.Attrs().Name, err)
+			}
+			continue
+		}
+
+		if err := o.syncRoutes(link, ips); err != nil {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to set routes of interface %s: %v", link.Attrs().Name, err)
+		}
+	}
+
+	return firstErr
+}
+
+func (o *Overlay) syncRoutes(link netlink.Link, ips map[string]bool) error {
+	existing, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, route := range existing {
+		if route.Dst == nil {
+			continue
+		}
+		ip := route.Dst.IP.String()
+		if ips[ip] {
+			delete(ips, ip)
+			continue
+		}
+		if err := netlink.RouteDel(&route); err != nil {
+			log.Errorf("Failed to delete route %v: %v", route, err)
+			lastErr = err
+		}
+	}
+
+	for ip := range ips {
+		dst, err := hostNet(ip)
+		if err != nil {
+			return err
+		}
+		route := &netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Dst:       dst,
+		}
+		if err := netlink.RouteReplace(route); err != nil {
+			log.Errorf("Failed to add route %v: %v", route, err)
+			lastErr = err
+		} else {
+			log.Infof("Added route to %s through %s", ip, link.Attrs().Name)
+		}
+	}
+
+	return lastErr
+}
+
+// interfaceStats returns the name and the byte counters of the interface
+// to the host, if any
+func (o *Overlay) interfaceStats(host string) (string, uint64, uint64) {
+	if o.Mode != ModeInterface {
+		return "", 0, 0
+	}
+
+	name := o.vtiName(host)
+	link, err := netlink.LinkByName(name)
+	if err != nil || link.Attrs().Statistics == nil {
+		return "", 0, 0
+	}
+	stats := link.Attrs().Statistics
+	return name, stats.RxBytes, stats.TxBytes
+}
+
+func hostNet(ip string) (*net.IPNet, error) {
+	bits := 32
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		bits = 128
+	}
+	_, ipNet, err := net.ParseCIDR(ip + "/" + strconv.Itoa(bits))
+	return ipNet, err
+}
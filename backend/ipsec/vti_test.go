@@ -0,0 +1,86 @@
+package ipsec
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rancher/ipsec/store"
+)
+
+// collidingHosts returns two host IPs whose keys collide in the overlay
+func collidingHosts(t *testing.T, o *Overlay) (string, string) {
+	seen := map[uint32]string{}
+	for i := 0; i < 1<<16; i++ {
+		host := fmt.Sprintf("10.%d.%d.1", i>>8, i&0xff)
+		key := o.vtiHash(host)
+		if other, ok := seen[key]; ok {
+			return other, host
+		}
+		seen[key] = host
+	}
+	t.Fatal("no colliding hosts found")
+	return "", ""
+}
+
+func TestAssignVTIKeys(t *testing.T) {
+	for _, network := range []string{"", "blue"} {
+		probe := &Overlay{Network: network}
+		first, second := collidingHosts(t, probe)
+		if second < first {
+			first, second = second, first
+		}
+		hosts := []string{second, "192.168.0.1", first}
+
+		entries := []store.Entry{}
+		for i, host := range hosts {
+			entries = append(entries, store.Entry{IPAddress: fmt.Sprintf("10.42.0.%d/16", i+1), HostIPAddress: host})
+		}
+		o, cleanup := newTestOverlay(t, testStore{Self: entries[1], Entries: entries, LocalSubnet: "10.42.0.0/16"})
+		o.Network = network
+		if network != "" {
+			o.NetworkID = 7
+		}
+
+		if o.vtiKey(first) != o.vtiKey(second) {
+			t.Fatalf("%q: expected %s and %s to collide before the keys are assigned", network, first, second)
+		}
+		o.assignVTIKeys()
+
+		keys := map[uint32]string{}
+		for _, host := range hosts {
+			key := o.vtiKey(host)
+			if other, ok := keys[key]; ok {
+				t.Errorf("%q: hosts %s and %s share the key %08x", network, other, host, key)
+			}
+			keys[key] = host
+			if key&networkMarkMask != o.mark() {
+				t.Errorf("%q: key %08x of %s lacks the bits of the network", network, key, host)
+			}
+		}
+		if o.vtiKey(first) != o.mark()|o.vtiHash(first) {
+			t.Errorf("%q: expected %s, the first in order, to keep its hash", network, first)
+		}
+		if o.vxlanMAC(first).String() == o.vxlanMAC(second).String() {
+			t.Errorf("%q: hosts %s and %s share a VXLAN MAC address", network, first, second)
+		}
+		if o.vtiName(first) == o.vtiName(second) {
+			t.Errorf("%q: hosts %s and %s share an interface name", network, first, second)
+		}
+
+		// Another host, seeing the entries in another order, agrees on
+		// the keys
+		reversed := []store.Entry{entries[2], entries[1], entries[0]}
+		other, cleanupOther := newTestOverlay(t, testStore{Self: entries[0], Entries: reversed, LocalSubnet: "10.42.0.0/16"})
+		other.Network = o.Network
+		other.NetworkID = o.NetworkID
+		other.assignVTIKeys()
+		for _, host := range hosts {
+			if other.vtiKey(host) != o.vtiKey(host) {
+				t.Errorf("%q: hosts disagree on the key of %s: %08x and %08x", network, host, o.vtiKey(host), other.vtiKey(host))
+			}
+		}
+
+		cleanupOther()
+		cleanup()
+	}
+}
@@ -0,0 +1,368 @@
+package ipsec
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+	"github.com/vishvananda/netlink"
+)
+
+// ModeVXLAN carries the traffic of the containers over a VXLAN overlay
+// between the hosts, and only protects the VXLAN traffic between every
+// pair of hosts with transport mode ESP. The policies then scale with the
+// hosts instead of the containers.
+const ModeVXLAN = "vxlan"
+
+const (
+	// DefaultVXLANPort is the default UDP port of the VXLAN traffic of
+	// the agent network
+	DefaultVXLANPort = 4789
+
+	// DefaultVXLANNetworkPortBase is the default UDP port of the VXLAN
+	// traffic of the additional network with the ID 1, the ones of the
+	// other networks follow it. It stays clear of 4790, used by
+	// VXLAN-GPE.
+	DefaultVXLANNetworkPortBase = 4800
+
+	// vxlanOverhead is the size of the outer IPv4, UDP and VXLAN headers
+	// with the inner Ethernet header
+	vxlanOverhead = 50
+
+	// espOverhead is the most the transport mode ESP with NAT traversal
+	// adds to a packet: the UDP encapsulation, the ESP header, the IV, the
+	// padding, the trailer and the ICV
+	espOverhead = 8 + 8 + 16 + 15 + 2 + 16
+
+	defaultUnderlayMTU = 1500
+)
+
+// vxlanPort returns the UDP port of the VXLAN traffic of the overlay. Each
+// network gets its own so their transport policies don't overlap.
+func (o *Overlay) vxlanPort() int {
+	if o.Network == "" {
+		return o.VXLANPort
+	}
+	return o.VXLANNetworkPortBase + o.NetworkID - 1
+}
+
+// vxlanBlockPriority returns the priority of the policy dropping the VXLAN
+// traffic of the overlay which didn't come through an SA. It's a lower
+// precedence than the one of the transport policies of the peers.
+func (o *Overlay) vxlanBlockPriority() int {
+	return 20000 + o.NetworkID
+}
+
+// vxlanMTU returns the MTU of the VXLAN interface, leaving room for the
+// VXLAN and ESP headers in the MTU of the interface of the local host
+// address
+func (o *Overlay) vxlanMTU() int {
+	mtu := defaultUnderlayMTU
+	links, err := netlink.LinkList()
+	if err != nil {
+		log.Errorf("Failed to list the interfaces, assuming an MTU of %d: %v", mtu, err)
+	}
+	for _, link := range links {
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.IP.String() == o.db.LocalHostIPAddress() {
+				mtu = link.Attrs().MTU
+			}
+		}
+	}
+	return mtu - vxlanOverhead - espOverhead
+}
+
+// vxlanName returns the name of the VXLAN interface of the overlay
+func (o *Overlay) vxlanName() string {
+	if o.Network == "" {
+		return "ipsec-vxlan"
+	}
+	return fmt.Sprintf("ipsecvx%08x", o.vtiKey(""))
+}
+
+// vxlanMAC returns the MAC address of the VXLAN interface of the host.
+// It's derived from the host so the peers know it without learning.
+func (o *Overlay) vxlanMAC(host string) net.HardwareAddr {
+	key := o.vtiKey(host)
+	return net.HardwareAddr{0x02, 0x52, byte(key >> 24), byte(key >> 16), byte(key >> 8), byte(key)}
+}
+
+// addVXLANRules adds the transport mode policies protecting the VXLAN
+// traffic to and from the host of hop
+func (o *Overlay) addVXLANRules(hop store.Entry, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
+	remoteEndpoint := o.remoteEndpoint(hop)
+	localIP := net.ParseIP(o.localEndpoint(remoteEndpoint))
+	remoteHostIP := net.ParseIP(remoteEndpoint)
+	if localIP == nil || remoteHostIP == nil || localIP.To4() == nil || remoteHostIP.To4() == nil {
+		return fmt.Errorf("the %s data plane mode needs IPv4 endpoints, got %s", ModeVXLAN, remoteEndpoint)
+	}
+
+	localNet, err := hostNet(localIP.String())
+	if err != nil {
+		return err
+	}
+	remoteNet, err := hostNet(remoteHostIP.String())
+	if err != nil {
+		return err
+	}
+
+	outPolicy := netlink.XfrmPolicy{
+		Src:      localNet,
+		Dst:      remoteNet,
+		Proto:    netlink.Proto(syscall.IPPROTO_UDP),
+		DstPort:  o.vxlanPort(),
+		Dir:      netlink.XFRM_DIR_OUT,
+		Priority: 10000,
+		Tmpls: []netlink.XfrmPolicyTmpl{
+			{
+				Src:   localIP,
+				Dst:   remoteHostIP,
+				Proto: netlink.XFRM_PROTO_ESP,
+				Mode:  netlink.XFRM_MODE_TRANSPORT,
+				Reqid: o.ReqID,
+			},
+		},
+	}
+	inPolicy := netlink.XfrmPolicy{
+		Src:      remoteNet,
+		Dst:      localNet,
+		Proto:    netlink.Proto(syscall.IPPROTO_UDP),
+		DstPort:  o.vxlanPort(),
+		Dir:      netlink.XFRM_DIR_IN,
+		Priority: 10000,
+		Tmpls: []netlink.XfrmPolicyTmpl{
+			{
+				Src:   remoteHostIP,
+				Dst:   localIP,
+				Proto: netlink.XFRM_PROTO_ESP,
+				Mode:  netlink.XFRM_MODE_TRANSPORT,
+				Reqid: o.ReqID,
+			},
+		},
+	}
+
+	for _, policy := range []netlink.XfrmPolicy{outPolicy, inPolicy} {
+		xfrm.Want(policy, existingPolicies, policiesToAdd)
+	}
+
+	return nil
+}
+
+// addVXLANBlockRule adds the policy dropping the VXLAN traffic of the
+// overlay from any source, so only the one coming through the SAs of the
+// transport policies of the peers gets to the VXLAN interface
+func (o *Overlay) addVXLANBlockRule(existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) {
+	anyNet := &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+	policy := netlink.XfrmPolicy{
+		Src:      anyNet,
+		Dst:      anyNet,
+		Proto:    netlink.Proto(syscall.IPPROTO_UDP),
+		DstPort:  o.vxlanPort(),
+		Dir:      netlink.XFRM_DIR_IN,
+		Priority: o.vxlanBlockPriority(),
+		Action:   netlink.XFRM_POLICY_BLOCK,
+	}
+
+	xfrm.Want(policy, existingPolicies, policiesToAdd)
+}
+
+// ensureVXLAN creates the VXLAN interface of the overlay, replacing the
+// existing one if its settings changed
+func (o *Overlay) ensureVXLAN() (netlink.Link, error) {
+	name := o.vxlanName()
+	mac := o.vxlanMAC(o.db.LocalHostIPAddress())
+	mtu := o.vxlanMTU()
+	if link, err := netlink.LinkByName(name); err == nil {
+		vxlan, ok := link.(*netlink.Vxlan)
+		if ok && vxlan.VxlanId == o.ReqID && vxlan.Port == o.vxlanPort() && vxlan.HardwareAddr.String() == mac.String() {
+			if vxlan.MTU != mtu {
+				if err := netlink.LinkSetMTU(link, mtu); err != nil {
+					return nil, err
+				}
+			}
+			return link, netlink.LinkSetUp(link)
+		}
+		log.Infof("Replacing interface %s", name)
+		if err := netlink.LinkDel(link); err != nil {
+			return nil, err
+		}
+	}
+
+	vxlan := &netlink.Vxlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:         name,
+			HardwareAddr: mac,
+			MTU:          mtu,
+		},
+		VxlanId:  o.ReqID,
+		Port:     o.vxlanPort(),
+		Learning: false,
+	}
+	if err := netlink.LinkAdd(vxlan); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Added interface %s", name)
+	return vxlan, netlink.LinkSetUp(vxlan)
+}
+
+// syncVXLAN routes the remote container IPs through the VXLAN interface to
+// their next hop, with static neighbor and forwarding entries, and removes
+// the ones no longer used. The interface is removed in the other modes.
+func (o *Overlay) syncVXLAN(routes map[string]string) error {
+	if o.Mode != ModeVXLAN {
+		return o.removeVXLAN()
+	}
+
+	link, err := o.ensureVXLAN()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	ips := map[string]bool{}
+	for ip := range routes {
+		ips[ip] = true
+	}
+	if err := o.syncRoutes(link, ips); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to set routes of interface %s: %v", link.Attrs().Name, err)
+	}
+
+	hosts := map[string]net.HardwareAddr{}
+	for _, host := range routes {
+		hosts[host] = o.vxlanMAC(host)
+	}
+	if err := o.syncNeighbors(link, routes); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to set neighbors of interface %s: %v", link.Attrs().Name, err)
+	}
+	if err := o.syncForwarding(link, hosts); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to set forwarding entries of interface %s: %v", link.Attrs().Name, err)
+	}
+
+	return firstErr
+}
+
+func (o *Overlay) removeVXLAN() error {
+	link, err := netlink.LinkByName(o.vxlanName())
+	if err != nil {
+		return nil
+	}
+	log.Infof("Removing interface %s", o.vxlanName())
+	return netlink.LinkDel(link)
+}
+
+// syncNeighbors points the remote container IPs to the MAC address of the
+// VXLAN interface of their next hop
+func (o *Overlay) syncNeighbors(link netlink.Link, routes map[string]string) error {
+	existing, err := netlink.NeighList(link.Attrs().Index, netlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, neigh := range existing {
+		if neigh.IP == nil || neigh.State&netlink.NUD_PERMANENT == 0 {
+			continue
+		}
+		host, ok := routes[neigh.IP.String()]
+		if ok && neigh.HardwareAddr.String() == o.vxlanMAC(host).String() {
+			continue
+		}
+		if err := netlink.NeighDel(&neigh); err != nil {
+			log.Errorf("Failed to delete neighbor %s: %v", neigh.IP, err)
+			lastErr = err
+		}
+	}
+
+	for ip, host := range routes {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			continue
+		}
+		family := netlink.FAMILY_V4
+		if parsed.To4() == nil {
+			family = netlink.FAMILY_V6
+		}
+		neigh := &netlink.Neigh{
+			LinkIndex:    link.Attrs().Index,
+			Family:       family,
+			State:        netlink.NUD_PERMANENT,
+			IP:           parsed,
+			HardwareAddr: o.vxlanMAC(host),
+		}
+		if err := netlink.NeighSet(neigh); err != nil {
+			log.Errorf("Failed to set neighbor %s: %v", ip, err)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// syncForwarding sends the frames to the MAC address of the VXLAN
+// interface of every next hop to the endpoint of its host
+func (o *Overlay) syncForwarding(link netlink.Link, hosts map[string]net.HardwareAddr) error {
+	existing, err := netlink.NeighList(link.Attrs().Index, syscall.AF_BRIDGE)
+	if err != nil {
+		return err
+	}
+
+	dsts := map[string]string{}
+	for host, mac := range hosts {
+		dsts[mac.String()] = o.remoteEndpoint(o.hostEntry(host))
+	}
+
+	var lastErr error
+	for _, fdb := range existing {
+		if fdb.IP == nil {
+			continue
+		}
+		mac := fdb.HardwareAddr.String()
+		if dsts[mac] == fdb.IP.String() {
+			delete(dsts, mac)
+			continue
+		}
+		if err := netlink.NeighDel(&fdb); err != nil {
+			log.Errorf("Failed to delete forwarding entry %s: %v", mac, err)
+			lastErr = err
+		}
+	}
+
+	for mac, dst := range dsts {
+		hwAddr, _ := net.ParseMAC(mac)
+		fdb := &netlink.Neigh{
+			LinkIndex:    link.Attrs().Index,
+			Family:       syscall.AF_BRIDGE,
+			Flags:        netlink.NTF_SELF,
+			State:        netlink.NUD_PERMANENT,
+			IP:           net.ParseIP(dst),
+			HardwareAddr: hwAddr,
+		}
+		if err := netlink.NeighSet(fdb); err != nil {
+			log.Errorf("Failed to set forwarding entry %s: %v", mac, err)
+			lastErr = err
+		} else {
+			log.Infof("Forwarding %s through %s to %s", mac, link.Attrs().Name, dst)
+		}
+	}
+
+	return lastErr
+}
+
+// hostEntry returns an entry of the host, for the endpoint selection
+func (o *Overlay) hostEntry(host string) store.Entry {
+	for _, entry := range o.db.Entries() {
+		if entry.HostIPAddress == host {
+			return entry
+		}
+	}
+	return store.Entry{HostIPAddress: host}
+}
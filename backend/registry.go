@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rancher/go-rancher-metadata/metadata"
+	"github.com/rancher/ipsec/store"
+)
+
+// Options are the settings a backend is created with
+type Options struct {
+	// ConfigDir holds the keys and the templates of the backend
+	ConfigDir string
+
+	// StateDir keeps the state handed over to the next agent. When empty
+	// the ipsec backend keeps none and the static one keeps its key
+	// generations in ConfigDir.
+	StateDir string
+
+	// DB is the store the backend reads its entries from
+	DB store.Store
+
+	// Metadata is nil when the entries don't come from metadata
+	Metadata metadata.Client
+
+	// Config holds the settings specific to the backend, of the Options
+	// type of its package. The defaults are used when it's nil.
+	Config interface{}
+}
+
+// Factory creates a backend with the given options
+type Factory func(opts Options) (Backend, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = map[string]Factory{}
+)
+
+// Register makes a backend available under the given name, replacing the
+// one previously registered with it. The backend packages register
+// themselves when imported.
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	factories[name] = factory
+}
+
+// New creates the backend registered under the given name
+func New(name string, opts Options) (Backend, error) {
+	factoriesLock.Lock()
+	factory, ok := factories[name]
+	factoriesLock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown backend: %s, available: %v", name, Names())
+	}
+	return factory(opts)
+}
+
+// Names returns the names of the registered backends
+func Names() []string {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	names := []string{}
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
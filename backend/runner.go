@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"sort"
+
+	"github.com/rancher/log"
+)
+
+// Runner queues the reconcile runs of a backend and carries them out one
+// at a time, keeping them in a History
+type Runner struct {
+	history *History
+	runs    chan string
+	stop    <-chan struct{}
+}
+
+// NewRunner creates a Runner remembering up to size runs. Once stop is
+// closed the runs aren't processed anymore.
+func NewRunner(size int, stop <-chan struct{}) *Runner {
+	return &Runner{
+		history: NewHistory(size),
+		runs:    make(chan string, 1),
+		stop:    stop,
+	}
+}
+
+// Submit queues a reconcile and returns the ID of the run which will carry
+// it out
+func (r *Runner) Submit(trigger Trigger, version string) string {
+	id, queued := r.history.Queue(trigger, version)
+	if queued {
+		// Once stopped, nothing takes the runs anymore and the run
+		// stays queued
+		select {
+		case r.runs <- id:
+		case <-r.stop:
+		}
+	}
+	log.Debugf("Reconcile requested by %s, run: %s", trigger, id)
+	return id
+}
+
+// Runs returns the recent reconcile runs
+func (r *Runner) Runs() []Run {
+	return r.history.List()
+}
+
+// Process carries out the queued runs with reload until stopped
+func (r *Runner) Process(reload func(*Run) error) {
+	for {
+		var id string
+		select {
+		case id = <-r.runs:
+		case <-r.stop:
+			return
+		}
+
+		run, ok := r.history.Start(id)
+		if !ok {
+			continue
+		}
+		err := reload(&run)
+		if err != nil {
+			log.Errorf("failed to reload overlay: %v", err)
+		}
+		r.history.Finish(run, err)
+	}
+}
+
+// Run carries out a run with reload right away, outside of the queue
+func (r *Runner) Run(trigger Trigger, reload func(*Run) error) error {
+	run := r.history.Begin(trigger, "")
+	err := reload(&run)
+	r.history.Finish(run, err)
+	return err
+}
+
+// PeerResults returns the outcome of the setup of every host, sorted by
+// host
+func PeerResults(peers map[string]error) []PeerResult {
+	results := []PeerResult{}
+	for host, err := range peers {
+		result := PeerResult{
+			Host: host,
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Host < results[j].Host
+	})
+	return results
+}
+
+// HandleErr logs the error and returns the first one of a reconcile, so
+// it goes on with the other steps and reports the first failure
+func HandleErr(firstErr, err error, fmt string, args ...interface{}) error {
+	log.Errorf(fmt, args...)
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeerResults(t *testing.T) {
+	results := PeerResults(map[string]error{
+		"10.0.0.3": nil,
+		"10.0.0.1": errors.New("failed"),
+		"10.0.0.2": nil,
+	})
+	expected := []PeerResult{
+		{Host: "10.0.0.1", Error: "failed"},
+		{Host: "10.0.0.2"},
+		{Host: "10.0.0.3"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	stop := make(chan struct{})
+	r := NewRunner(10, stop)
+
+	if err := r.Run(TriggerStartup, func(run *Run) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	id := r.Submit(TriggerAPI, "")
+	// A run is already waiting, the next request joins it
+	if again := r.Submit(TriggerMonitor, ""); again != id {
+		t.Errorf("expected run %s, got %s", id, again)
+	}
+
+	done := make(chan string)
+	go r.Process(func(run *Run) error {
+		done <- run.ID
+		return errors.New("failed")
+	})
+	select {
+	case processed := <-done:
+		if processed != id {
+			t.Errorf("expected run %s, got %s", id, processed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run wasn't processed")
+	}
+	close(stop)
+
+	// The run is finished once reload returned, after the processed one
+	// was received
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runs := r.Runs()
+		if len(runs) != 2 {
+			t.Fatalf("expected 2 runs, got %v", runs)
+		}
+		if runs[1].State == RunFailed {
+			if runs[0].State != RunSucceeded || runs[1].Error != "failed" {
+				t.Errorf("unexpected runs %v", runs)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the run didn't finish: %v", runs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+package backend
+
+import "strings"
+
+// Status holds a summary of the state of a backend
+type Status struct {
+	Backend          string `json:"backend"`
+	LocalHost        string `json:"localHost"`
+	LocalSubnet      string `json:"localSubnet"`
+	Peers            int    `json:"peers"`
+	EstablishedPeers int    `json:"establishedPeers"`
+	Policies         int    `json:"policies"`
+}
+
+// Peer holds the state of the connection to a remote host
+type Peer struct {
+	Host       string `json:"host"`
+	Connection string `json:"connection"`
+	Loaded     bool   `json:"loaded"`
+
+	// Network is the additional network the connection carries, empty
+	// for the network of the agent
+	Network string `json:"network,omitempty"`
+
+	// State is the state of the SA to the host, empty when there's none
+	State   string `json:"state,omitempty"`
+	Entries int    `json:"entries"`
+
+	// Interface is the interface to the host in the interface mode,
+	// with its counters
+	Interface string `json:"interface,omitempty"`
+	BytesIn   uint64 `json:"bytesIn,omitempty"`
+	BytesOut  uint64 `json:"bytesOut,omitempty"`
+}
+
+// SA holds the state of a single CHILD_SA
+type SA struct {
+	Name     string   `json:"name"`
+	Host     string   `json:"host"`
+	State    string   `json:"state"`
+	ReqID    string   `json:"reqId"`
+	Mode     string   `json:"mode"`
+	SPIIn    string   `json:"spiIn"`
+	SPIOut   string   `json:"spiOut"`
+	BytesIn  uint64   `json:"bytesIn"`
+	BytesOut uint64   `json:"bytesOut"`
+	LocalTS  []string `json:"localTs"`
+	RemoteTS []string `json:"remoteTs"`
+	Network  string   `json:"network,omitempty"`
+}
+
+// Policy holds a kernel policy managed by the backend
+type Policy struct {
+	Dir      string `json:"dir"`
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	TmplSrc  string `json:"tmplSrc"`
+	TmplDst  string `json:"tmplDst"`
+	ReqID    int    `json:"reqId"`
+	Priority int    `json:"priority"`
+	Network  string `json:"network,omitempty"`
+}
+
+// PeerID returns the ID InitiatePeer and TerminatePeer take for the peer:
+// its host for the network of the agent, host@network for an additional
+// network
+func PeerID(host, network string) string {
+	if network == "" {
+		return host
+	}
+	return host + "@" + network
+}
+
+// ParsePeerID returns the host and the network of the peer ID
+func ParsePeerID(id string) (string, string) {
+	parts := strings.SplitN(id, "@", 2)
+	if len(parts) == 1 {
+		return id, ""
+	}
+	return parts[0], parts[1]
+}
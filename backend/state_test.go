@@ -0,0 +1,27 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestPeerID(t *testing.T) {
+	tests := []struct {
+		host    string
+		network string
+		id      string
+	}{
+		{host: "10.0.0.2", id: "10.0.0.2"},
+		{host: "10.0.0.2", network: "blue", id: "10.0.0.2@blue"},
+		{host: "fd00::2", network: "blue", id: "fd00::2@blue"},
+	}
+
+	for _, test := range tests {
+		if id := PeerID(test.host, test.network); id != test.id {
+			t.Errorf("%s %q: expected %s, got %s", test.host, test.network, test.id, id)
+		}
+		host, network := ParsePeerID(test.id)
+		if host != test.host || network != test.network {
+			t.Errorf("%s: expected %s %q, got %s %q", test.id, test.host, test.network, host, network)
+		}
+	}
+}
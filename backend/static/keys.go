@@ -0,0 +1,159 @@
+package static
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rancher/log"
+)
+
+const (
+	// The SAs encrypt with AES-CBC, whose IVs the kernel generates at
+	// random, and authenticate with HMAC-SHA256. Unlike GCM, the traffic
+	// stays safe when an SA is installed again with the same key and its
+	// sequence numbers start over.
+	cryptAlgo   = "cbc(aes)"
+	cryptKeyLen = 16
+	authAlgo    = "hmac(sha256)"
+	authKeyLen  = 32
+	authICVLen  = 128
+
+	// replayWindow is the number of packets the SAs accept out of order,
+	// with extended sequence numbers which never wrap
+	replayWindow = 128
+
+	// generations is the number of keys of every period and direction.
+	// A host installing the SA to a peer again within a period uses
+	// another one, so the peer's replay protection doesn't drop its
+	// packets, and the peer accepts any of them.
+	generations = 4
+
+	generationsFile = "generations.json"
+)
+
+// epoch returns the number of the key period the time falls in
+func (o *Overlay) epoch(t time.Time) int64 {
+	return t.Unix() / int64(o.RotateInterval/time.Second)
+}
+
+// nextRotation returns when the key period after the one of the time starts
+func (o *Overlay) nextRotation(t time.Time) time.Time {
+	return time.Unix((o.epoch(t)+1)*int64(o.RotateInterval/time.Second), 0)
+}
+
+// saKeys holds the SPI and the keys of an SA
+type saKeys struct {
+	spi      int
+	cryptKey []byte
+	authKey  []byte
+}
+
+// deriveKeys returns the SPI and the keys of the SA carrying the traffic
+// from src to dst during the epoch with the given generation. Both hosts
+// derive the same ones from the PSK, and the keys of the two directions
+// differ.
+func deriveKeys(psk, src, dst string, epoch int64, generation int) saKeys {
+	material := []byte{}
+	for block := 1; len(material) < 4+cryptKeyLen+authKeyLen; block++ {
+		mac := hmac.New(sha256.New, []byte(psk))
+		fmt.Fprintf(mac, "rancher-ipsec-static|%s|%s|%d|%d|%d", src, dst, epoch, generation, block)
+		material = mac.Sum(material)
+	}
+
+	// SPIs below 256 are reserved
+	spi := binary.BigEndian.Uint32(material[:4]) | 0x80000000
+	return saKeys{
+		spi:      int(spi),
+		cryptKey: material[4 : 4+cryptKeyLen],
+		authKey:  material[4+cryptKeyLen : 4+cryptKeyLen+authKeyLen],
+	}
+}
+
+// usedGenerations are the generations of the keys a host installed the SA
+// to a peer with during an epoch
+type usedGenerations struct {
+	Epoch int64 `json:"epoch"`
+	Used  []int `json:"used"`
+}
+
+func (o *Overlay) stateDir() string {
+	if o.StateDir == "" {
+		return o.configDir
+	}
+	return o.StateDir
+}
+
+// loadGenerations reads the generations used by the previous runs of the
+// agent, they're all considered free when the file is missing
+func (o *Overlay) loadGenerations() map[string]usedGenerations {
+	generations := map[string]usedGenerations{}
+	content, err := ioutil.ReadFile(path.Join(o.stateDir(), generationsFile))
+	if err == nil {
+		err = json.Unmarshal(content, &generations)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Failed to read the used key generations: %v", err)
+	}
+	return generations
+}
+
+func (o *Overlay) saveGenerations() error {
+	content, err := json.Marshal(o.generations)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(o.stateDir(), 0700); err != nil {
+		return err
+	}
+	file := path.Join(o.stateDir(), generationsFile)
+	if err := ioutil.WriteFile(file+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// nextGeneration picks a generation not used yet during the epoch for the
+// SA to the host, at random when the previous ones are unknown, and
+// records it
+func (o *Overlay) nextGeneration(host string, epoch int64) (int, error) {
+	if o.generations == nil {
+		o.generations = o.loadGenerations()
+	}
+
+	used := o.generations[host]
+	if used.Epoch != epoch {
+		used = usedGenerations{Epoch: epoch}
+	}
+
+	free := []int{}
+	for g := 0; g < generations; g++ {
+		isUsed := false
+		for _, u := range used.Used {
+			isUsed = isUsed || u == g
+		}
+		if !isUsed {
+			free = append(free, g)
+		}
+	}
+	if len(free) == 0 {
+		return 0, fmt.Errorf("all the keys to %s of the current period were used, waiting for the rotation at %v", host, o.nextRotation(time.Now()))
+	}
+
+	pick := make([]byte, 1)
+	if _, err := rand.Read(pick); err != nil {
+		return 0, err
+	}
+	g := free[int(pick[0])%len(free)]
+	used.Used = append(used.Used, g)
+	o.generations[host] = used
+	return g, o.saveGenerations()
+}
@@ -0,0 +1,48 @@
+package static
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKeys(t *testing.T) {
+	// Every host derives the keys of its peers, they must not change
+	// between versions of the agent
+	keys := deriveKeys("secret", "10.0.0.1", "10.0.0.2", 100, 0)
+	if keys.spi != 0x9524408d {
+		t.Errorf("expected SPI 9524408d, got %08x", keys.spi)
+	}
+	if got := hex.EncodeToString(keys.cryptKey); got != "9d3a2e4f4a92ba265da34617833b7591" {
+		t.Errorf("unexpected encryption key %s", got)
+	}
+	if got := hex.EncodeToString(keys.authKey); got != "d75d28c8f26df5bf28c0da742bf0725e36a4c3796fb0fecdabfb75e5ff4729d8" {
+		t.Errorf("unexpected authentication key %s", got)
+	}
+
+	tests := []struct {
+		name       string
+		psk        string
+		src, dst   string
+		epoch      int64
+		generation int
+	}{
+		{name: "other direction", psk: "secret", src: "10.0.0.2", dst: "10.0.0.1", epoch: 100},
+		{name: "other epoch", psk: "secret", src: "10.0.0.1", dst: "10.0.0.2", epoch: 101},
+		{name: "other generation", psk: "secret", src: "10.0.0.1", dst: "10.0.0.2", epoch: 100, generation: 1},
+		{name: "other PSK", psk: "other", src: "10.0.0.1", dst: "10.0.0.2", epoch: 100},
+		{name: "other host", psk: "secret", src: "10.0.0.1", dst: "10.0.0.3", epoch: 100},
+	}
+
+	for _, test := range tests {
+		other := deriveKeys(test.psk, test.src, test.dst, test.epoch, test.generation)
+		if other.spi == keys.spi || string(other.cryptKey) == string(keys.cryptKey) || string(other.authKey) == string(keys.authKey) {
+			t.Errorf("%s: expected other SPI and keys", test.name)
+		}
+		if other.spi&0x80000000 == 0 {
+			t.Errorf("%s: SPI %08x in the reserved range", test.name, other.spi)
+		}
+		if len(other.cryptKey) != cryptKeyLen || len(other.authKey) != authKeyLen {
+			t.Errorf("%s: unexpected key lengths %d and %d", test.name, len(other.cryptKey), len(other.authKey))
+		}
+	}
+}
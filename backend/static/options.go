@@ -0,0 +1,35 @@
+package static
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rancher/ipsec/backend"
+)
+
+// Name is the name the backend is registered under
+const Name = "static"
+
+func init() {
+	backend.Register(Name, newBackend)
+}
+
+// Options are the settings of the backend, the rotation interval left
+// empty keeps DefaultRotateInterval
+type Options struct {
+	RotateInterval time.Duration
+}
+
+func newBackend(opts backend.Options) (backend.Backend, error) {
+	config, ok := opts.Config.(Options)
+	if !ok && opts.Config != nil {
+		return nil, fmt.Errorf("invalid options for the %s backend: %T", Name, opts.Config)
+	}
+
+	o := NewOverlay(opts.ConfigDir, opts.DB, opts.Metadata)
+	o.StateDir = opts.StateDir
+	if config.RotateInterval != 0 {
+		o.RotateInterval = config.RotateInterval
+	}
+	return o, nil
+}
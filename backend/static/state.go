@@ -0,0 +1,201 @@
+package static
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+)
+
+const (
+	backendName = "static"
+
+	// stateInstalled is the state of the peers with SAs in both directions
+	stateInstalled = "INSTALLED"
+)
+
+// EffectiveConfig describes the configuration the overlay applies to
+// the SAs to its peers
+type EffectiveConfig struct {
+	Algorithm      string `json:"algorithm"`
+	RotateInterval string `json:"rotateInterval"`
+	Epoch          int64  `json:"epoch"`
+	NextRotation   string `json:"nextRotation"`
+	ReqID          int    `json:"reqId"`
+}
+
+// EffectiveConfig returns the configuration currently used for the SAs
+func (o *Overlay) EffectiveConfig() interface{} {
+	now := time.Now()
+	return EffectiveConfig{
+		Algorithm:      cryptAlgo + "+" + authAlgo,
+		RotateInterval: o.RotateInterval.String(),
+		Epoch:          o.epoch(now),
+		NextRotation:   o.nextRotation(now).UTC().Format(time.RFC3339),
+		ReqID:          o.ReqID,
+	}
+}
+
+// Status returns a summary of the state of the overlay
+func (o *Overlay) Status() (backend.Status, error) {
+	peers, err := o.Peers()
+	if err != nil {
+		return backend.Status{}, err
+	}
+
+	policies, err := o.Policies()
+	if err != nil {
+		return backend.Status{}, err
+	}
+
+	status := backend.Status{
+		Backend:     backendName,
+		LocalHost:   o.db.LocalHostIPAddress(),
+		LocalSubnet: o.db.LocalSubnet(),
+		Peers:       len(peers),
+		Policies:    len(policies),
+	}
+	for _, peer := range peers {
+		if peer.State == stateInstalled {
+			status.EstablishedPeers++
+		}
+	}
+
+	return status, nil
+}
+
+// Peers returns the state of the SAs to the remote hosts
+func (o *Overlay) Peers() ([]backend.Peer, error) {
+	states, err := o.getStates()
+	if err != nil {
+		return nil, err
+	}
+
+	localHostIP := o.db.LocalHostIPAddress()
+	out, in := map[string]bool{}, map[string]bool{}
+	for _, state := range states {
+		if state.Src.String() == localHostIP {
+			out[state.Dst.String()] = true
+		} else {
+			in[state.Src.String()] = true
+		}
+	}
+
+	entries := map[string]int{}
+	for _, entry := range o.db.Entries() {
+		if entry.HostIPAddress != localHostIP {
+			entries[entry.HostIPAddress]++
+		}
+	}
+
+	peers := []backend.Peer{}
+	for host, count := range entries {
+		peer := backend.Peer{
+			Host:    host,
+			Loaded:  out[host],
+			Entries: count,
+		}
+		if out[host] && in[host] {
+			peer.State = stateInstalled
+		}
+		peers = append(peers, peer)
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Host < peers[j].Host
+	})
+	return peers, nil
+}
+
+// isEpochState tells whether the SPI is the one of an SA from src to dst
+// during the epoch, whatever its generation
+func (o *Overlay) isEpochState(src, dst string, epoch int64, spi int) bool {
+	for g := 0; g < generations; g++ {
+		if deriveKeys(o.psk, src, dst, epoch, g).spi == spi {
+			return true
+		}
+	}
+	return false
+}
+
+// SAs returns the SAs of the current epoch, one for every pair of
+// directions to a host
+func (o *Overlay) SAs() ([]backend.SA, error) {
+	states, err := o.getStates()
+	if err != nil {
+		return nil, err
+	}
+
+	localHostIP := o.db.LocalHostIPAddress()
+	epoch := o.epoch(time.Now())
+
+	sas := map[string]*backend.SA{}
+	for _, state := range states {
+		host, outbound := state.Dst.String(), true
+		if state.Src.String() != localHostIP {
+			host, outbound = state.Src.String(), false
+		}
+
+		src, dst := localHostIP, host
+		if !outbound {
+			src, dst = host, localHostIP
+		}
+		if !o.isEpochState(src, dst, epoch, state.Spi) {
+			continue
+		}
+
+		sa, ok := sas[host]
+		if !ok {
+			sa = &backend.SA{
+				Name:  fmt.Sprintf("static-%s", host),
+				Host:  host,
+				State: stateInstalled,
+				ReqID: fmt.Sprint(state.Reqid),
+				Mode:  state.Mode.String(),
+			}
+			sas[host] = sa
+		}
+		// The peer sends on one of the inbound SAs of the epoch, the
+		// one which carried the most traffic is reported
+		spi := fmt.Sprintf("%08x", uint32(state.Spi))
+		if outbound {
+			sa.SPIOut = spi
+			sa.BytesOut = state.Statistics.Bytes
+		} else if sa.SPIIn == "" || state.Statistics.Bytes > sa.BytesIn {
+			sa.SPIIn = spi
+			sa.BytesIn = state.Statistics.Bytes
+		}
+	}
+
+	ret := []backend.SA{}
+	for _, sa := range sas {
+		ret = append(ret, *sa)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Host < ret[j].Host
+	})
+	return ret, nil
+}
+
+// Policies returns the xfrm policies managed by the overlay
+func (o *Overlay) Policies() ([]backend.Policy, error) {
+	policies, err := o.getRules()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []backend.Policy{}
+	for _, policy := range policies {
+		ret = append(ret, xfrm.ToPolicy(policy))
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Dst != ret[j].Dst {
+			return ret[i].Dst < ret[j].Dst
+		}
+		return ret[i].Dir < ret[j].Dir
+	})
+	return ret, nil
+}
@@ -0,0 +1,464 @@
+package static
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/go-rancher-metadata/metadata"
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/backend/internal/xfrm"
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/ipsec/store"
+	"github.com/rancher/log"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	reqID          = 1234
+	pskFile        = "psk.txt"
+	runHistorySize = 20
+
+	// DefaultRotateInterval is the default lifetime of the keys
+	DefaultRotateInterval = time.Hour
+)
+
+// Overlay programs the xfrm states and policies between the hosts
+// directly, with keys derived from the PSK for every pair of hosts and
+// rotated every RotateInterval, without any IKE daemon. The tunnels run
+// between the host addresses, without NAT traversal, so it's meant for
+// test rigs and air-gapped setups.
+type Overlay struct {
+	sync.Mutex
+	runLock sync.Mutex
+
+	configDir string
+	db        store.Store
+	mc        metadata.Client
+	psk       string
+	runner    *backend.Runner
+	stop      chan struct{}
+	stopOnce  sync.Once
+
+	// generations are the generations of the keys used for the SAs to
+	// every host during the current epoch
+	generations map[string]usedGenerations
+
+	RotateInterval time.Duration
+	ReqID          int
+
+	// StateDir keeps the generations of the keys used, so the next agent
+	// doesn't use them again, the config directory when empty
+	StateDir string
+}
+
+// NewOverlay creates a new Overlay. The metadata client can be nil when
+// the store doesn't come from metadata, the entries are then reloaded on
+// rotation and on request only.
+func NewOverlay(configDir string, db store.Store, mc metadata.Client) *Overlay {
+	stop := make(chan struct{})
+	return &Overlay{
+		configDir:      configDir,
+		db:             db,
+		mc:             mc,
+		runner:         backend.NewRunner(runHistorySize, stop),
+		stop:           stop,
+		RotateInterval: DefaultRotateInterval,
+		ReqID:          reqID,
+	}
+}
+
+// Start begins processing the reconcile runs, the arguments about charon
+// are ignored
+func (o *Overlay) Start(launch bool, logFile string) {
+	go o.runner.Process(o.reload)
+	go o.rotate()
+	if o.mc != nil {
+		go o.mc.OnChange(5, o.onChange)
+	}
+}
+
+// Stop stops the reconcile runs, the rotation and the handling of the
+// metadata changes, and waits for the run in progress. The states and policies are left as they are.
+func (o *Overlay) Stop() error {
+	o.stopOnce.Do(func() {
+		close(o.stop)
+	})
+	o.runLock.Lock()
+	defer o.runLock.Unlock()
+	return nil
+}
+
+// Cleanup removes the policies and SAs of the overlay
+func (o *Overlay) Cleanup() error {
+	o.Lock()
+	defer o.Unlock()
+	log.Infof("Cleaning up")
+
+	var firstErr error
+	policies, err := o.getRules()
+	if err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to list rules: %v", err)
+	} else if _, err := xfrm.DeletePolicies(policies); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to remove policies: %v", err)
+	}
+
+	states, err := o.getStates()
+	if err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to list SAs: %v", err)
+	} else if err := o.deleteStates(states); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to remove SAs: %v", err)
+	}
+
+	return firstErr
+}
+
+// Handover has nothing to save, the next agent derives the same keys and
+// adopts the states and policies as they are
+func (o *Overlay) Handover() error {
+	return nil
+}
+
+// InitiatePeer isn't supported, the SAs are installed with the keys of
+// the current period on every reconcile
+func (o *Overlay) InitiatePeer(host string) error {
+	return backend.ErrNotSupported
+}
+
+// TerminatePeer isn't supported, there's no negotiation to tear down
+func (o *Overlay) TerminatePeer(host string) error {
+	return backend.ErrNotSupported
+}
+
+// WatchPeers isn't supported, the SAs only change on a reconcile
+func (o *Overlay) WatchPeers(stop <-chan struct{}, updown func(id string, up bool)) error {
+	return backend.ErrNotSupported
+}
+
+// onChange ignores the changes once the overlay is stopped, the metadata
+// client keeps polling
+func (o *Overlay) onChange(version string) {
+	if o.stopped() {
+		return
+	}
+	o.Submit(backend.TriggerMetadata, version)
+}
+
+// stopped tells whether Stop was called
+func (o *Overlay) stopped() bool {
+	select {
+	case <-o.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// rotate reconciles at the start of every key period, installing the
+// keys of the new one
+func (o *Overlay) rotate() {
+	for {
+		select {
+		case <-time.After(time.Until(o.nextRotation(time.Now()))):
+			o.Submit(backend.TriggerRotate, "")
+		case <-o.stop:
+			return
+		}
+	}
+}
+
+// Submit queues a reconcile of the overlay and returns the ID of the run
+// which will carry it out
+func (o *Overlay) Submit(trigger backend.Trigger, version string) string {
+	return o.runner.Submit(trigger, version)
+}
+
+// Runs returns the recent reconcile runs of the overlay
+func (o *Overlay) Runs() []backend.Run {
+	return o.runner.Runs()
+}
+
+// Reload is used to refresh the state of the overlay network
+func (o *Overlay) Reload() error {
+	return o.runner.Run(backend.TriggerStartup, o.reload)
+}
+
+func (o *Overlay) reload(run *backend.Run) error {
+	o.runLock.Lock()
+	defer o.runLock.Unlock()
+
+	if o.mc != nil && run.MetadataVersion == "" {
+		if version, err := o.mc.GetVersion(); err == nil {
+			run.MetadataVersion = version
+		}
+	}
+
+	if err := o.db.Reload(); err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(path.Join(o.configDir, pskFile))
+	if err != nil {
+		return err
+	}
+	o.psk = strings.TrimSpace(string(content))
+
+	return o.configure(run)
+}
+
+func (o *Overlay) configure(run *backend.Run) error {
+	o.Lock()
+	defer o.Unlock()
+	log.Infof("Reconfiguring")
+
+	var firstErr error
+	localHostIP := o.db.LocalHostIPAddress()
+	epoch := o.epoch(time.Now())
+
+	existingStates, err := o.getStates()
+	if err != nil {
+		return err
+	}
+	existingPolicies, err := o.getRules()
+	if err != nil {
+		return err
+	}
+
+	statesToAdd := map[string]netlink.XfrmState{}
+	policiesToAdd := map[string]netlink.XfrmPolicy{}
+	peers := map[string]error{}
+
+	for _, entry := range o.db.Entries() {
+		if entry.HostIPAddress == localHostIP || entry.HostIPAddress == "" {
+			continue
+		}
+		if _, ok := peers[entry.HostIPAddress]; !ok {
+			peers[entry.HostIPAddress] = o.addStates(entry.HostIPAddress, epoch, existingStates, statesToAdd)
+			if err := peers[entry.HostIPAddress]; err != nil {
+				firstErr = backend.HandleErr(firstErr, err, "Failed to set up SAs for host %s: %v", entry.HostIPAddress, err)
+			}
+		}
+
+		if err := o.addRules(entry, existingPolicies, policiesToAdd); err != nil {
+			firstErr = backend.HandleErr(firstErr, err, "Failed to add rules for host %s, ip %s : %v", entry.HostIPAddress, entry.IPAddress, err)
+			if peers[entry.HostIPAddress] == nil {
+				peers[entry.HostIPAddress] = err
+			}
+		}
+	}
+
+	run.Peers = backend.PeerResults(peers)
+
+	// The new SAs go in before the policies using them, the old ones
+	// go away once nothing uses them anymore
+	if err := o.installStates(statesToAdd); err != nil {
+		firstErr = backend.HandleErr(firstErr, err, "Failed to add SAs: %v", err)
+	}
+
+	if firstErr == nil {
+		run.PoliciesAdded, firstErr = xfrm.AddPolicies(policiesToAdd)
+	}
+
+	if firstErr == nil {
+		run.PoliciesRemoved, firstErr = xfrm.DeletePolicies(existingPolicies)
+	}
+
+	if firstErr == nil {
+		firstErr = o.deleteStates(existingStates)
+	}
+
+	return firstErr
+}
+
+// addStates adds the SA to the host for the current epoch and the ones
+// from it for every generation of the epochs around it, so the hosts keep
+// talking while their clocks are a little apart
+func (o *Overlay) addStates(host string, epoch int64, existingStates map[string]netlink.XfrmState, statesToAdd map[string]netlink.XfrmState) error {
+	localHostIP := o.db.LocalHostIPAddress()
+	local, remote := net.ParseIP(localHostIP), net.ParseIP(host)
+	if local == nil || remote == nil {
+		return fmt.Errorf("invalid host addresses %s and %s", localHostIP, host)
+	}
+
+	outbound, err := o.outboundState(local, remote, epoch, existingStates)
+	if err != nil {
+		return err
+	}
+
+	states := []netlink.XfrmState{outbound}
+	for e := epoch - 1; e <= epoch+1; e++ {
+		for g := 0; g < generations; g++ {
+			states = append(states, o.newState(remote, local, e, g))
+		}
+	}
+
+	for _, state := range states {
+		key := stateKey(&state)
+		if _, ok := existingStates[key]; ok {
+			delete(existingStates, key)
+		} else {
+			statesToAdd[key] = state
+		}
+	}
+
+	return nil
+}
+
+// outboundState returns the SA to the host for the epoch, the installed
+// one when there's one, otherwise one with keys of a generation not used
+// yet, whose sequence numbers the host hasn't seen
+func (o *Overlay) outboundState(local, remote net.IP, epoch int64, existingStates map[string]netlink.XfrmState) (netlink.XfrmState, error) {
+	for g := 0; g < generations; g++ {
+		state := o.newState(local, remote, epoch, g)
+		if _, ok := existingStates[stateKey(&state)]; ok {
+			return state, nil
+		}
+	}
+
+	g, err := o.nextGeneration(remote.String(), epoch)
+	if err != nil {
+		return netlink.XfrmState{}, err
+	}
+	return o.newState(local, remote, epoch, g), nil
+}
+
+func (o *Overlay) newState(src, dst net.IP, epoch int64, generation int) netlink.XfrmState {
+	keys := deriveKeys(o.psk, src.String(), dst.String(), epoch, generation)
+	return netlink.XfrmState{
+		Src:   src,
+		Dst:   dst,
+		Proto: netlink.XFRM_PROTO_ESP,
+		Mode:  netlink.XFRM_MODE_TUNNEL,
+		Spi:   keys.spi,
+		Reqid: o.ReqID,
+		Crypt: &netlink.XfrmStateAlgo{
+			Name: cryptAlgo,
+			Key:  keys.cryptKey,
+		},
+		Auth: &netlink.XfrmStateAlgo{
+			Name:        authAlgo,
+			Key:         keys.authKey,
+			TruncateLen: authICVLen,
+		},
+		ReplayWindow: replayWindow,
+		ESN:          true,
+	}
+}
+
+func (o *Overlay) installStates(states map[string]netlink.XfrmState) error {
+	var lastErr error
+	for key, state := range states {
+		if err := netlink.XfrmStateAdd(&state); err != nil {
+			log.Errorf("Failed to add SA %s: %v", key, err)
+			lastErr = err
+		} else {
+			log.Infof("Added SA %s", key)
+			events.Publish(events.KeyLoaded, map[string]string{"owner": state.Dst.String(), "spi": fmt.Sprintf("0x%x", state.Spi)})
+		}
+	}
+	return lastErr
+}
+
+func (o *Overlay) deleteStates(states map[string]netlink.XfrmState) error {
+	var lastErr error
+	for key, state := range states {
+		if err := netlink.XfrmStateDel(&state); err != nil {
+			log.Errorf("Failed to delete SA %s: %v", key, err)
+			lastErr = err
+		} else {
+			log.Infof("Deleted SA %s", key)
+		}
+	}
+	return lastErr
+}
+
+func (o *Overlay) getStates() (map[string]netlink.XfrmState, error) {
+	existing, err := netlink.XfrmStateList(netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]netlink.XfrmState{}
+	for _, state := range existing {
+		if state.Reqid != o.ReqID {
+			continue
+		}
+		states[stateKey(&state)] = state
+	}
+	return states, nil
+}
+
+func stateKey(s *netlink.XfrmState) string {
+	return fmt.Sprintf("%s-%s-0x%x", s.Src, s.Dst, s.Spi)
+}
+
+func (o *Overlay) addRules(entry store.Entry, existingPolicies map[string]netlink.XfrmPolicy, policiesToAdd map[string]netlink.XfrmPolicy) error {
+	localSubnet, ipDirectNet, err := xfrm.Selectors(o.db, entry)
+	if err != nil || localSubnet == nil {
+		return err
+	}
+
+	localHostIP := net.ParseIP(o.db.LocalHostIPAddress())
+	remoteHostIP := net.ParseIP(entry.HostIPAddress)
+
+	policies := []netlink.XfrmPolicy{
+		{
+			Src:      localSubnet,
+			Dst:      ipDirectNet,
+			Dir:      netlink.XFRM_DIR_OUT,
+			Priority: 10000,
+			Tmpls: []netlink.XfrmPolicyTmpl{
+				{
+					Src:   localHostIP,
+					Dst:   remoteHostIP,
+					Proto: netlink.XFRM_PROTO_ESP,
+					Mode:  netlink.XFRM_MODE_TUNNEL,
+					Reqid: o.ReqID,
+				},
+			},
+		},
+	}
+	for _, dir := range []netlink.Dir{netlink.XFRM_DIR_IN, netlink.XFRM_DIR_FWD} {
+		policies = append(policies, netlink.XfrmPolicy{
+			Src:      ipDirectNet,
+			Dst:      localSubnet,
+			Dir:      dir,
+			Priority: 10000,
+			Tmpls: []netlink.XfrmPolicyTmpl{
+				{
+					Src:   remoteHostIP,
+					Dst:   localHostIP,
+					Proto: netlink.XFRM_PROTO_ESP,
+					Mode:  netlink.XFRM_MODE_TUNNEL,
+					Reqid: o.ReqID,
+				},
+			},
+		})
+	}
+
+	for _, policy := range policies {
+		xfrm.Want(policy, existingPolicies, policiesToAdd)
+	}
+
+	return nil
+}
+
+func (o *Overlay) getRules() (map[string]netlink.XfrmPolicy, error) {
+	existing, err := netlink.XfrmPolicyList(netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := map[string]netlink.XfrmPolicy{}
+	for _, policy := range existing {
+		if len(policy.Tmpls) == 0 || policy.Tmpls[0].Reqid != o.ReqID {
+			continue
+		}
+		policies[xfrm.Key(&policy)] = policy
+	}
+	return policies, nil
+}
@@ -0,0 +1,194 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rancher/log"
+)
+
+// Types of the events published by the agent
+const (
+	PeerUp            = "peer-up"
+	PeerDown          = "peer-down"
+	PeerFailing       = "peer-failing"
+	ConnectionLoaded  = "connection-loaded"
+	ConnectionRemoved = "connection-removed"
+	PolicyAdded       = "policy-added"
+	PolicyDeleted     = "policy-deleted"
+	KeyLoaded         = "key-loaded"
+	CharonStarted     = "charon-started"
+	CharonRestarted   = "charon-restarted"
+	CharonKilled      = "charon-killed"
+	CharonExited      = "charon-exited"
+	ARPReply          = "arp-reply"
+	ARPIgnored        = "arp-ignored"
+	NDPReply          = "ndp-reply"
+	NDPIgnored        = "ndp-ignored"
+	EntryRemote       = "entry-remote"
+	EntryLocal        = "entry-local"
+	EntryRemoved      = "entry-removed"
+	IPConflict        = "ip-conflict"
+
+	// IPConflictResolved is published when a duplicate IP, reported once
+	// by IPConflict, isn't used on several hosts anymore
+	IPConflictResolved = "ip-conflict-resolved"
+)
+
+// Kinds of the IPConflict events
+const (
+	// ConflictDuplicate is an IP used by containers on different hosts
+	ConflictDuplicate = "duplicate"
+
+	// ConflictRemoteClaimed is an IP the store places on a remote host
+	// which a device on the local interface uses
+	ConflictRemoteClaimed = "remote-claimed"
+)
+
+// NetworkKey holds, in the data of the entry and conflict events, the
+// additional network the IP belongs to. It's not set for the network of
+// the agent.
+const NetworkKey = "network"
+
+const subscriberBufferSize = 256
+
+// DefaultFlushTimeout is how long the agent waits for the events to be
+// delivered before exiting, on a fatal error or a shutdown
+const DefaultFlushTimeout = 5 * time.Second
+
+// Event holds the information about a single change in the overlay
+type Event struct {
+	Type string            `json:"type"`
+	Time time.Time         `json:"time"`
+	Data map[string]string `json:"data,omitempty"`
+
+	// Seq orders the events published by a broker
+	Seq uint64 `json:"-"`
+}
+
+// FlushFunc waits, until the deadline, for the events up to seq to be
+// delivered by a subscriber which handles them asynchronously
+type FlushFunc func(seq uint64, deadline time.Time)
+
+// Broker distributes published events to all the subscribers
+type Broker struct {
+	sync.Mutex
+
+	nextID      int
+	subscribers map[int]chan Event
+	seq         uint64
+	flushers    []FlushFunc
+}
+
+var defaultBroker = NewBroker()
+
+// NewBroker creates a new Broker
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[int]chan Event{},
+	}
+}
+
+// Publish sends the event to all the subscribers. Subscribers which
+// can't keep up miss events rather than block the publisher.
+func (b *Broker) Publish(eventType string, data map[string]string) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.seq++
+	event := Event{
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+		Seq:  b.seq,
+	}
+
+	for id, c := range b.subscribers {
+		select {
+		case c <- event:
+		default:
+			log.Debugf("Dropping %s event for slow subscriber %d", eventType, id)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving all the events published from now
+// on and a function to be called once the subscriber is done, which closes
+// the channel
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	b.Lock()
+	defer b.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	c := make(chan Event, subscriberBufferSize)
+	b.subscribers[id] = c
+
+	return c, func() {
+		b.Lock()
+		defer b.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(c)
+		}
+	}
+}
+
+// OnFlush registers a function waiting for the events to be delivered by
+// an asynchronous subscriber on Flush
+func (b *Broker) OnFlush(f FlushFunc) {
+	b.Lock()
+	defer b.Unlock()
+	b.flushers = append(b.flushers, f)
+}
+
+// Flush waits, at most timeout, for the subscribers to receive the events
+// published so far and for the registered functions to deliver them. It's
+// meant to be called before exiting.
+func (b *Broker) Flush(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	b.Lock()
+	seq := b.seq
+	flushers := append([]FlushFunc{}, b.flushers...)
+	b.Unlock()
+
+	for time.Now().Before(deadline) && b.pending() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, f := range flushers {
+		f(seq, deadline)
+	}
+}
+
+// pending returns the number of events not received by the subscribers
+func (b *Broker) pending() int {
+	b.Lock()
+	defer b.Unlock()
+
+	n := 0
+	for _, c := range b.subscribers {
+		n += len(c)
+	}
+	return n
+}
+
+// Publish sends the event to the subscribers of the default broker
+func Publish(eventType string, data map[string]string) {
+	defaultBroker.Publish(eventType, data)
+}
+
+// Subscribe subscribes to the events of the default broker
+func Subscribe() (<-chan Event, func()) {
+	return defaultBroker.Subscribe()
+}
+
+// OnFlush registers a flush function on the default broker
+func OnFlush(f FlushFunc) {
+	defaultBroker.OnFlush(f)
+}
+
+// Flush flushes the events of the default broker
+func Flush(timeout time.Duration) {
+	defaultBroker.Flush(timeout)
+}
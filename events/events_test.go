@@ -0,0 +1,150 @@
+package events
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBrokerSeq(t *testing.T) {
+	b := NewBroker()
+	first, unsubscribeFirst := b.Subscribe()
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := b.Subscribe()
+	defer unsubscribeSecond()
+
+	for i := 0; i < 10; i++ {
+		b.Publish(PeerUp, map[string]string{"host": strconv.Itoa(i)})
+	}
+
+	for _, c := range []<-chan Event{first, second} {
+		for i := 0; i < 10; i++ {
+			event := <-c
+			if event.Seq != uint64(i+1) || event.Data["host"] != strconv.Itoa(i) || event.Type != PeerUp {
+				t.Errorf("event %d: unexpected %+v", i, event)
+			}
+		}
+	}
+}
+
+func TestBrokerDropOnFull(t *testing.T) {
+	b := NewBroker()
+	slow, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	// The publisher never blocks on the subscriber which doesn't read
+	published := subscriberBufferSize + 10
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < published; i++ {
+			b.Publish(PolicyAdded, nil)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a full subscriber")
+	}
+
+	if len(slow) != subscriberBufferSize {
+		t.Errorf("expected %d buffered events, got %d", subscriberBufferSize, len(slow))
+	}
+	// The first events are kept, the ones past the buffer dropped
+	if event := <-slow; event.Seq != 1 {
+		t.Errorf("expected the first event, got %d", event.Seq)
+	}
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	b := NewBroker()
+	c, unsubscribe := b.Subscribe()
+	b.Publish(PeerDown, nil)
+
+	unsubscribe()
+	// Calling it again is harmless
+	unsubscribe()
+
+	if _, ok := <-c; !ok {
+		t.Fatal("expected the event published before unsubscribing")
+	}
+	if _, ok := <-c; ok {
+		t.Fatal("expected the channel to be closed")
+	}
+
+	// Publishing after unsubscribing doesn't send on the closed channel
+	b.Publish(PeerDown, nil)
+}
+
+func TestBrokerFlush(t *testing.T) {
+	b := NewBroker()
+	c, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	var lock sync.Mutex
+	delivered := uint64(0)
+	b.OnFlush(func(seq uint64, deadline time.Time) {
+		for time.Now().Before(deadline) {
+			lock.Lock()
+			done := delivered >= seq
+			lock.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	go func() {
+		for event := range c {
+			time.Sleep(5 * time.Millisecond)
+			lock.Lock()
+			delivered = event.Seq
+			lock.Unlock()
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		b.Publish(CharonExited, nil)
+	}
+	b.Flush(5 * time.Second)
+
+	lock.Lock()
+	if delivered != 5 {
+		t.Errorf("expected the 5 events delivered after the flush, got %d", delivered)
+	}
+	lock.Unlock()
+}
+
+func TestBrokerFlushTimeout(t *testing.T) {
+	b := NewBroker()
+	// Nothing reads the events
+	_, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	var flushedSeq uint64
+	var flushedDeadline time.Time
+	b.OnFlush(func(seq uint64, deadline time.Time) {
+		flushedSeq, flushedDeadline = seq, deadline
+		time.Sleep(time.Until(deadline))
+	})
+
+	b.Publish(CharonExited, nil)
+	b.Publish(CharonExited, nil)
+
+	start := time.Now()
+	timeout := 100 * time.Millisecond
+	b.Flush(timeout)
+	elapsed := time.Since(start)
+
+	if elapsed < timeout || elapsed > 10*timeout {
+		t.Errorf("expected the flush to give up after %v, took %v", timeout, elapsed)
+	}
+	if flushedSeq != 2 {
+		t.Errorf("expected the flush function to wait for event 2, got %d", flushedSeq)
+	}
+	if flushedDeadline.Sub(start) > timeout+50*time.Millisecond {
+		t.Errorf("expected the flush function to share the deadline, got %v", flushedDeadline.Sub(start))
+	}
+}
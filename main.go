@@ -1,16 +1,29 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/rancher/go-rancher-metadata/metadata"
 	"github.com/rancher/ipsec/arp"
+	"github.com/rancher/ipsec/backend"
 	"github.com/rancher/ipsec/backend/ipsec"
+	"github.com/rancher/ipsec/backend/static"
+	"github.com/rancher/ipsec/events"
 	"github.com/rancher/ipsec/monitor"
 	"github.com/rancher/ipsec/server"
 	"github.com/rancher/ipsec/store"
+	"github.com/rancher/ipsec/webhook"
 	"github.com/rancher/log"
 	logserver "github.com/rancher/log/server"
 )
@@ -29,8 +42,31 @@ var (
 
 const (
 	metadataAddressFlag = "metadata-address"
+	redacted            = "<redacted>"
+
+	cleanupKeep   = "keep"
+	cleanupRemove = "remove"
+
+	// shutdownHandover hands the state over to the new agent, only on its
+	// request
+	shutdownHandover = "handover"
+
+	// handoverTokenFile in the state directory holds the token the next
+	// agent asks for the handover with
+	handoverTokenFile = "handover-token"
 )
 
+// secretFlags are the flags whose values are never exposed through the API
+var secretFlags = map[string]bool{
+	"webhook-secret": true,
+}
+
+// urlFlags are the flags whose URLs are exposed through the API with only
+// their scheme and host, the rest can carry credentials or tokens
+var urlFlags = map[string]bool{
+	"webhook-url": true,
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Version = VERSION
@@ -48,7 +84,8 @@ func main() {
 			Name: "charon-log",
 		},
 		cli.BoolFlag{
-			Name: "charon-launch",
+			Name:  "charon-launch",
+			Usage: "Launch charon and restart it when it exits. On a handover it's killed and the next agent launches its own, which negotiates the tunnels to every peer again, the SAs left in the kernel carry the traffic meanwhile",
 		},
 		cli.BoolFlag{
 			Name: "test-charon",
@@ -61,6 +98,16 @@ func main() {
 			Value:  "localhost:8111",
 			EnvVar: "RANCHER_SERVICE_LISTEN_PORT",
 		},
+		cli.StringFlag{
+			Name:   "grpc-listen",
+			Usage:  "Address to serve the gRPC control API on, host:port or unix:///path, disabled if empty. The API isn't authenticated, only loopback addresses are allowed unless --grpc-allow-remote",
+			EnvVar: "RANCHER_SERVICE_GRPC_LISTEN_PORT",
+		},
+		cli.BoolFlag{
+			Name:   "grpc-allow-remote",
+			Usage:  "Allow serving the gRPC control API on an address reachable from other hosts, anyone reaching it can reload the overlay and terminate tunnels",
+			EnvVar: "IPSEC_GRPC_ALLOW_REMOTE",
+		},
 		cli.StringFlag{
 			Name:   metadataAddressFlag,
 			Value:  store.DefaultMetadataAddress,
@@ -85,6 +132,144 @@ func main() {
 			Usage:  "IPSec Replay Window Size",
 			EnvVar: "IPSEC_REPLAY_WINDOW_SIZE",
 		},
+		cli.StringFlag{
+			Name:   "underlay",
+			Value:  ipsec.UnderlayAuto,
+			Usage:  "Address family preferred for the tunnels between hosts: auto, ipv4 or ipv6. The other one is used for the peers which lack it",
+			EnvVar: "IPSEC_UNDERLAY",
+		},
+		cli.StringFlag{
+			Name:   "endpoint-selection",
+			Value:  ipsec.EndpointByRegion,
+			Usage:  "Use the private endpoint label of the peers in the same region or environment, and the public one for the others",
+			EnvVar: "IPSEC_ENDPOINT_SELECTION",
+		},
+		cli.StringFlag{
+			Name:   "backend",
+			Usage:  "Data plane backend: ipsec, with charon negotiating the SAs, or static, with keys derived from the PSK and no IKE daemon",
+			Value:  ipsec.Name,
+			EnvVar: "IPSEC_BACKEND",
+		},
+		cli.DurationFlag{
+			Name:   "static-key-rotation",
+			Usage:  "How often the static backend rotates the keys of the SAs, all the hosts must use the same value",
+			Value:  static.DefaultRotateInterval,
+			EnvVar: "IPSEC_STATIC_KEY_ROTATION",
+		},
+		cli.StringFlag{
+			Name:   "shutdown-cleanup",
+			Usage:  "What to do with the state of the backend on SIGTERM: keep, for a fast restart, or remove, for uninstalling, every managed policy and connection",
+			Value:  cleanupKeep,
+			EnvVar: "IPSEC_SHUTDOWN_CLEANUP",
+		},
+		cli.StringFlag{
+			Name:   "state-dir",
+			Usage:  "Directory keeping the state handed over to the next agent on upgrade, on a volume the container of the next agent mounts too. Handovers are only allowed when it's set",
+			EnvVar: "IPSEC_STATE_DIR",
+		},
+		cli.StringFlag{
+			Name:   "store-file",
+			Usage:  "JSON file with the entries to use instead of metadata, for setups without Rancher",
+			EnvVar: "IPSEC_STORE_FILE",
+		},
+		cli.StringFlag{
+			Name:   "dataplane-mode",
+			Usage:  "How the traffic is matched to the tunnels: policy, with xfrm policies for every remote container, interface, with a VTI interface per peer and routes, or vxlan, with a VXLAN overlay between the hosts protected by transport mode ESP",
+			Value:  ipsec.ModePolicy,
+			EnvVar: "IPSEC_DATAPLANE_MODE",
+		},
+		cli.IntFlag{
+			Name:   "vxlan-port",
+			Usage:  "UDP port of the VXLAN traffic of the agent network in the vxlan data plane mode",
+			Value:  ipsec.DefaultVXLANPort,
+			EnvVar: "IPSEC_VXLAN_PORT",
+		},
+		cli.IntFlag{
+			Name:   "vxlan-network-port-base",
+			Usage:  "UDP port of the VXLAN traffic of the additional network with the ID 1 in the vxlan data plane mode, the network with the ID n uses this port plus n-1",
+			Value:  ipsec.DefaultVXLANNetworkPortBase,
+			EnvVar: "IPSEC_VXLAN_NETWORK_PORT_BASE",
+		},
+		cli.IntFlag{
+			Name:   "child-sas",
+			Usage:  "Number of CHILD_SAs to every peer, each one carrying the traffic to its own part of the network subnets",
+			Value:  ipsec.DefaultChildSAs,
+			EnvVar: "IPSEC_CHILD_SAS",
+		},
+		cli.StringSliceFlag{
+			Name:   "network",
+			Usage:  "Additional network served by the agent besides its own, as name or name:id, can be repeated. The ID, from 1 to 255 and derived from the name when not set, must be the same on every host. Its key and templates are read from the networks/<name> directory of --ipsec-config",
+			EnvVar: "IPSEC_NETWORKS",
+		},
+		cli.BoolFlag{
+			Name:   "region-gateways",
+			Usage:  "Tunnel the traffic between regions, or environments with --endpoint-selection environment, through the hosts labeled io.rancher.ipsec.gateway=true",
+			EnvVar: "IPSEC_REGION_GATEWAYS",
+		},
+		cli.StringSliceFlag{
+			Name:   "allowed-peer-groups",
+			Usage:  "Pair of peer groups, as group1:group2, whose hosts can reach each other, can be repeated. Hosts in different groups not listed get their traffic blocked, hosts without a group label are in the default group",
+			EnvVar: "IPSEC_ALLOWED_PEER_GROUPS",
+		},
+		cli.StringSliceFlag{
+			Name:   "webhook-url",
+			Usage:  "URL to notify about peer and charon incidents, can be repeated",
+			EnvVar: "IPSEC_WEBHOOK_URLS",
+		},
+		cli.StringFlag{
+			Name:   "webhook-secret",
+			Usage:  "Secret used to sign the webhook payloads, required with --webhook-url",
+			EnvVar: "IPSEC_WEBHOOK_SECRET",
+		},
+		cli.StringSliceFlag{
+			Name:   "arp-interface",
+			Usage:  "Interface to proxy ARP requests on, can be repeated (default: eth0)",
+			EnvVar: "IPSEC_ARP_INTERFACES",
+		},
+		cli.BoolFlag{
+			Name:   "arp-cni-bridge",
+			Usage:  "Proxy ARP requests on the bridge named in the CNI config of the network",
+			EnvVar: "IPSEC_ARP_CNI_BRIDGE",
+		},
+		cli.StringFlag{
+			Name:   "arp-mode",
+			Value:  arp.ModeSocket,
+			Usage:  "How ARP requests reach the proxy: socket reads all of them, bpf filters the ones for remote containers in the kernel",
+			EnvVar: "IPSEC_ARP_MODE",
+		},
+		cli.BoolFlag{
+			Name:   "arp-block-conflicts",
+			Usage:  "Stop answering ARP requests for remote IPs also used by a local device or another host",
+			EnvVar: "IPSEC_ARP_BLOCK_CONFLICTS",
+		},
+		cli.BoolFlag{
+			Name:   "ndp-proxy",
+			Usage:  "Also answer IPv6 Neighbor Solicitations for remote containers on the ARP interfaces",
+			EnvVar: "IPSEC_NDP_PROXY",
+		},
+		cli.BoolTFlag{
+			Name:   "arp-announce",
+			Usage:  "Send gratuitous ARPs when containers move between hosts",
+			EnvVar: "IPSEC_ARP_ANNOUNCE",
+		},
+		cli.IntFlag{
+			Name:   "arp-announce-rate",
+			Value:  arp.DefaultAnnounceRate,
+			Usage:  "Gratuitous ARPs sent per second when containers move between hosts",
+			EnvVar: "IPSEC_ARP_ANNOUNCE_RATE",
+		},
+		cli.IntFlag{
+			Name:   "arp-announce-burst",
+			Value:  arp.DefaultAnnounceBurst,
+			Usage:  "Gratuitous ARPs which can be sent at once before the rate applies",
+			EnvVar: "IPSEC_ARP_ANNOUNCE_BURST",
+		},
+		cli.IntFlag{
+			Name:   "peer-failure-threshold",
+			Value:  monitor.DefaultFailureThreshold,
+			Usage:  "Number of consecutive SA checks a peer can fail before it's reported as failing",
+			EnvVar: "IPSEC_PEER_FAILURE_THRESHOLD",
+		},
 	}
 	app.Action = func(ctx *cli.Context) {
 		if err := appMain(ctx); err != nil {
@@ -95,6 +280,50 @@ func main() {
 	app.Run(os.Args)
 }
 
+func settings(ctx *cli.Context) map[string]string {
+	s := map[string]string{}
+	for _, name := range ctx.GlobalFlagNames() {
+		value := fmt.Sprint(ctx.GlobalGeneric(name))
+		if secretFlags[name] && value != "" {
+			value = redacted
+		}
+		if urlFlags[name] {
+			urls := []string{}
+			for _, u := range ctx.GlobalStringSlice(name) {
+				urls = append(urls, redactURL(u))
+			}
+			value = fmt.Sprint(urls)
+		}
+		s[name] = value
+	}
+	return s
+}
+
+// redactURL keeps the scheme and the host of the URL, and redacts its user
+// info, path and query
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	if u.User == nil && strings.Trim(u.Path, "/") == "" && u.RawQuery == "" && u.Fragment == "" {
+		return u.String()
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+func arpInterfaces(ctx *cli.Context, db store.Store) []string {
+	interfaces := ctx.GlobalStringSlice("arp-interface")
+	if ctx.GlobalBool("arp-cni-bridge") {
+		if bridge := db.LocalBridge(); bridge != "" {
+			interfaces = append(interfaces, bridge)
+		} else {
+			log.Errorf("couldn't find a bridge in the CNI config, not proxying ARP on it")
+		}
+	}
+	return interfaces
+}
+
 func appMain(ctx *cli.Context) error {
 	logserver.StartServerWithDefaults()
 	if ctx.GlobalBool("test-charon") {
@@ -108,56 +337,326 @@ func appMain(ctx *cli.Context) error {
 		log.SetLevelString("debug")
 	}
 
+	cleanup := ctx.GlobalString("shutdown-cleanup")
+	if cleanup != cleanupKeep && cleanup != cleanupRemove {
+		return fmt.Errorf("unknown shutdown cleanup: %s", cleanup)
+	}
+
+	if ctx.GlobalInt("arp-announce-rate") < 1 {
+		return fmt.Errorf("invalid ARP announce rate: %d, must be at least 1", ctx.GlobalInt("arp-announce-rate"))
+	}
+	if ctx.GlobalInt("arp-announce-burst") < 1 {
+		return fmt.Errorf("invalid ARP announce burst: %d, must be at least 1", ctx.GlobalInt("arp-announce-burst"))
+	}
+	if len(ctx.GlobalStringSlice("webhook-url")) > 0 && ctx.GlobalString("webhook-secret") == "" {
+		return fmt.Errorf("--webhook-url needs a --webhook-secret to sign the payloads")
+	}
+	if ctx.GlobalInt("peer-failure-threshold") < 1 {
+		return fmt.Errorf("invalid peer failure threshold: %d, must be at least 1", ctx.GlobalInt("peer-failure-threshold"))
+	}
+
 	done := make(chan error)
 
-	log.Infof("Reading info from metadata")
-	metadataAddress := ctx.GlobalString(metadataAddressFlag)
-	if metadataAddress == "" {
-		metadataAddress = DefaultMetadataAddress
+	var mc metadata.Client
+	var db store.Store
+	if storeFile := ctx.GlobalString("store-file"); storeFile != "" {
+		log.Infof("Reading info from %s", storeFile)
+		fileDB := store.NewFileStore(storeFile)
+		if err := fileDB.Reload(); err != nil {
+			log.Errorf("Error reading store file: %v", err)
+			return err
+		}
+		db = fileDB
+	} else {
+		log.Infof("Reading info from metadata")
+		metadataAddress := ctx.GlobalString(metadataAddressFlag)
+		if metadataAddress == "" {
+			metadataAddress = DefaultMetadataAddress
+		}
+		metadataURL := fmt.Sprintf(metadataURLTemplate, metadataAddress)
+		var err error
+		mc, err = metadata.NewClientAndWait(metadataURL)
+		if err != nil {
+			log.Errorf("couldn't create metadata client: %v", err)
+			return nil
+		}
+
+		metadataDB, err := store.NewMetadataStore(mc)
+		if err != nil {
+			log.Errorf("Error creating metadata store: %v", err)
+			return err
+		}
+
+		metadataDB.Reload()
+		db = metadataDB
 	}
-	metadataURL := fmt.Sprintf(metadataURLTemplate, metadataAddress)
-	mc, err := metadata.NewClientAndWait(metadataURL)
+
+	networks, err := parseNetworks(ctx, mc)
 	if err != nil {
-		log.Errorf("couldn't create metadata client: %v", err)
-		return nil
+		return err
 	}
 
-	db, err := store.NewMetadataStore(mc)
+	opts := backend.Options{
+		ConfigDir: ctx.GlobalString("ipsec-config"),
+		StateDir:  ctx.GlobalString("state-dir"),
+		DB:        db,
+		Metadata:  mc,
+	}
+	switch ctx.GlobalString("backend") {
+	case ipsec.Name:
+		opts.Config, err = ipsecOptions(ctx, networks)
+	case static.Name:
+		opts.Config, err = staticOptions(ctx, networks)
+	}
 	if err != nil {
-		log.Errorf("Error creating metadata store: %v", err)
 		return err
 	}
 
-	db.Reload()
+	overlay, err := backend.New(ctx.GlobalString("backend"), opts)
+	if err != nil {
+		return err
+	}
 
-	ipsecOverlay := ipsec.NewOverlay(ctx.GlobalString("ipsec-config"), db, mc)
-	ipsecOverlay.ReplayWindowSize = ctx.GlobalString("ipsec-replay-window-size")
-	ipsecOverlay.IPSecIkeSaRekeyInterval = ctx.GlobalString("ipsec-ike-sa-rekey-interval")
-	ipsecOverlay.IPSecChildSaRekeyInterval = ctx.GlobalString("ipsec-child-sa-rekey-interval")
-	if !ctx.GlobalBool("gcm") {
-		ipsecOverlay.Blacklist = []string{"aes128gcm16"}
+	if urls := ctx.GlobalStringSlice("webhook-url"); len(urls) > 0 {
+		hostname, _ := os.Hostname()
+		webhook.NewNotifier(urls, ctx.GlobalString("webhook-secret"), hostname).Start()
 	}
-	overlay := ipsecOverlay
+
 	overlay.Start(ctx.GlobalBool("charon-launch"), ctx.GlobalString("charon-log"))
 
-	go func() {
-		done <- arp.ListenAndServe(db, "eth0")
-	}()
+	arpMode := ctx.GlobalString("arp-mode")
+	if arpMode != arp.ModeSocket && arpMode != arp.ModeBPF {
+		return fmt.Errorf("unknown ARP mode: %s", arpMode)
+	}
+
+	arpProxy := arp.NewProxy(db, arpInterfaces(ctx, db))
+	arpProxy.Mode = arpMode
+	arpProxy.NDP = ctx.GlobalBool("ndp-proxy")
+	arpProxy.Announce = ctx.GlobalBoolT("arp-announce")
+	arpProxy.AnnounceRate = ctx.GlobalInt("arp-announce-rate")
+	arpProxy.AnnounceBurst = ctx.GlobalInt("arp-announce-burst")
+	arpProxy.BlockConflicts = ctx.GlobalBool("arp-block-conflicts")
+	arpProxy.Start()
+	arpProxies := map[string]*arp.Proxy{"": arpProxy}
+
+	// The bridges of the additional networks get their own proxy
+	if ctx.GlobalBool("arp-cni-bridge") {
+		for _, network := range networks {
+			networkDB := network.DB
+			bridge := networkDB.LocalBridge()
+			if bridge == "" || bridge == db.LocalBridge() {
+				continue
+			}
+			networkProxy := arp.NewProxy(networkDB, []string{bridge})
+			networkProxy.Network = network.Name
+			networkProxy.Mode = arpMode
+			networkProxy.NDP = arpProxy.NDP
+			networkProxy.Announce = arpProxy.Announce
+			networkProxy.AnnounceRate = arpProxy.AnnounceRate
+			networkProxy.AnnounceBurst = arpProxy.AnnounceBurst
+			networkProxy.BlockConflicts = arpProxy.BlockConflicts
+			networkProxy.Start()
+			arpProxies[network.Name] = networkProxy
+		}
+	}
+
+	handover := make(chan struct{}, 1)
+	s := server.Server{
+		Backend:         overlay,
+		ARP:             arpProxies,
+		Settings:        settings(ctx),
+		GRPCAllowRemote: ctx.GlobalBool("grpc-allow-remote"),
+	}
+	if stateDir := ctx.GlobalString("state-dir"); stateDir != "" {
+		token, err := newHandoverToken(stateDir)
+		if err != nil {
+			return err
+		}
+		s.HandoverToken = token
+		s.Handover = func() {
+			select {
+			case handover <- struct{}{}:
+			default:
+			}
+		}
+	}
 
 	listenPort := ctx.GlobalString("listen")
 	log.Debugf("About to start server and listen on port: %v", listenPort)
 	go func() {
-		s := server.Server{
-			Backend: overlay,
-		}
 		done <- s.ListenAndServe(listenPort)
 	}()
 
+	if grpcListen := ctx.GlobalString("grpc-listen"); grpcListen != "" {
+		go func() {
+			done <- s.ListenAndServeGRPC(grpcListen)
+		}()
+	}
+
 	if err := overlay.Reload(); err != nil {
 		log.Errorf("couldn't reload the overlay for first time: %v. But not to worry as the next metadata refresh will fix it", err)
 	}
 
-	monitor.Watch(mc)
+	sm := monitor.Watch(mc, overlay, ctx.GlobalInt("peer-failure-threshold"))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Infof("Received %v, shutting down", sig)
+			done <- shutdown(overlay, arpProxies, sm, cleanup)
+		case <-handover:
+			// The state is left for the new agent whatever the
+			// cleanup policy
+			log.Infof("Handing over to the new agent")
+			done <- shutdown(overlay, arpProxies, sm, shutdownHandover)
+		}
+	}()
 
 	return <-done
 }
+
+// shutdown stops the reconcile loop, the ARP proxies and the SA monitor, in
+// this order. The state of the backend is then left in place with
+// cleanupKeep, removed with cleanupRemove or handed over to the next agent
+// with shutdownHandover, and the pending events are delivered.
+func shutdown(overlay backend.Backend, arpProxies map[string]*arp.Proxy, sm *monitor.SAsMonitor, cleanup string) error {
+	if err := overlay.Stop(); err != nil {
+		return err
+	}
+	for _, arpProxy := range arpProxies {
+		arpProxy.Stop()
+	}
+	sm.Stop()
+
+	var err error
+	switch cleanup {
+	case cleanupRemove:
+		err = overlay.Cleanup()
+	case shutdownHandover:
+		err = overlay.Handover()
+	default:
+		log.Infof("Leaving the policies and connections in place")
+	}
+
+	// The events of the last moments, charon exiting for instance, are
+	// delivered before the agent exits
+	events.Flush(events.DefaultFlushTimeout)
+	return err
+}
+
+// newHandoverToken writes a new random token to the state directory, the
+// next agent reads it from there to ask for the handover
+func newHandoverToken(stateDir string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return "", err
+	}
+	return token, ioutil.WriteFile(path.Join(stateDir, handoverTokenFile), []byte(token), 0600)
+}
+
+// parseNetworks creates the stores of the additional networks
+func parseNetworks(ctx *cli.Context, mc metadata.Client) ([]ipsec.Network, error) {
+	var networks []ipsec.Network
+	for _, network := range ctx.GlobalStringSlice("network") {
+		name, id, err := ipsec.ParseNetwork(network)
+		if err != nil {
+			return nil, err
+		}
+		if mc == nil {
+			return nil, fmt.Errorf("additional networks need metadata")
+		}
+		networkDB, err := store.NewMetadataStore(mc)
+		if err != nil {
+			log.Errorf("Error creating metadata store for network %s: %v", name, err)
+			return nil, err
+		}
+		networkDB.Network = name
+		networkDB.Reload()
+		networks = append(networks, ipsec.Network{Name: name, ID: id, DB: networkDB})
+	}
+	return networks, nil
+}
+
+// staticOptions returns the options of the backend with static keys
+func staticOptions(ctx *cli.Context, networks []ipsec.Network) (static.Options, error) {
+	if len(networks) > 0 {
+		return static.Options{}, fmt.Errorf("additional networks need the %s backend", ipsec.Name)
+	}
+	rotateInterval := ctx.GlobalDuration("static-key-rotation")
+	if rotateInterval < time.Minute {
+		return static.Options{}, fmt.Errorf("invalid key rotation interval: %v", rotateInterval)
+	}
+	return static.Options{RotateInterval: rotateInterval}, nil
+}
+
+// ipsecOptions returns the options of the charon backend, with the
+// additional networks
+func ipsecOptions(ctx *cli.Context, networks []ipsec.Network) (ipsec.Options, error) {
+	opts := ipsec.Options{
+		ReplayWindowSize:          ctx.GlobalString("ipsec-replay-window-size"),
+		IPSecIkeSaRekeyInterval:   ctx.GlobalString("ipsec-ike-sa-rekey-interval"),
+		IPSecChildSaRekeyInterval: ctx.GlobalString("ipsec-child-sa-rekey-interval"),
+		Underlay:                  ctx.GlobalString("underlay"),
+		EndpointSelection:         ctx.GlobalString("endpoint-selection"),
+		Gateways:                  ctx.GlobalBool("region-gateways"),
+		ChildSAs:                  ctx.GlobalInt("child-sas"),
+		Mode:                      ctx.GlobalString("dataplane-mode"),
+		VXLANPort:                 ctx.GlobalInt("vxlan-port"),
+		VXLANNetworkPortBase:      ctx.GlobalInt("vxlan-network-port-base"),
+		Networks:                  networks,
+	}
+	switch opts.Underlay {
+	case ipsec.UnderlayAuto, ipsec.UnderlayIPv4, ipsec.UnderlayIPv6:
+	default:
+		return opts, fmt.Errorf("unknown underlay: %s", opts.Underlay)
+	}
+	if opts.EndpointSelection != ipsec.EndpointByRegion &&
+		opts.EndpointSelection != ipsec.EndpointByEnvironment {
+		return opts, fmt.Errorf("unknown endpoint selection: %s", opts.EndpointSelection)
+	}
+	if opts.ChildSAs < 1 || opts.ChildSAs > ipsec.MaxChildSAs {
+		return opts, fmt.Errorf("invalid number of CHILD_SAs: %d, must be between 1 and %d", opts.ChildSAs, ipsec.MaxChildSAs)
+	}
+	if opts.ChildSAs > 1 && opts.Gateways {
+		return opts, fmt.Errorf("several CHILD_SAs per peer can't be used with region gateways")
+	}
+	switch opts.Mode {
+	case ipsec.ModePolicy:
+	case ipsec.ModeInterface, ipsec.ModeVXLAN:
+		if opts.ChildSAs > 1 {
+			return opts, fmt.Errorf("several CHILD_SAs per peer need the %s data plane mode", ipsec.ModePolicy)
+		}
+	default:
+		return opts, fmt.Errorf("unknown data plane mode: %s", opts.Mode)
+	}
+	if opts.Mode == ipsec.ModeVXLAN && opts.Underlay == ipsec.UnderlayIPv6 {
+		return opts, fmt.Errorf("the %s data plane mode needs an IPv4 underlay", ipsec.ModeVXLAN)
+	}
+	if opts.VXLANPort < 1 || opts.VXLANPort > 65535 {
+		return opts, fmt.Errorf("invalid VXLAN port: %d, must be between 1 and 65535", opts.VXLANPort)
+	}
+	lastNetworkPort := opts.VXLANNetworkPortBase + ipsec.MaxNetworkID - 1
+	if opts.VXLANNetworkPortBase < 1 || lastNetworkPort > 65535 {
+		return opts, fmt.Errorf("invalid VXLAN network port base: %d, must be between 1 and %d", opts.VXLANNetworkPortBase, 65535-ipsec.MaxNetworkID+1)
+	}
+	if opts.VXLANPort >= opts.VXLANNetworkPortBase && opts.VXLANPort <= lastNetworkPort {
+		return opts, fmt.Errorf("the VXLAN port %d is one of the ports of the additional networks, %d to %d", opts.VXLANPort, opts.VXLANNetworkPortBase, lastNetworkPort)
+	}
+
+	var err error
+	opts.AllowedPeerGroups, err = ipsec.ParsePeerGroupPairs(ctx.GlobalStringSlice("allowed-peer-groups"))
+	if err != nil {
+		return opts, err
+	}
+	if !ctx.GlobalBool("gcm") {
+		opts.Blacklist = []string{"aes128gcm16"}
+	}
+	return opts, nil
+}
@@ -1,127 +1,187 @@
 package monitor
 
 import (
-	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/bronze1man/goStrongswanVici"
 	"github.com/rancher/go-rancher-metadata/metadata"
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/events"
 	"github.com/rancher/log"
 )
 
 // SAsMonitor ...
 type SAsMonitor struct {
-	mc metadata.Client
+	mc               metadata.Client
+	backend          backend.Backend
+	peers            map[string]bool
+	failures         map[string]int
+	failureThreshold int
+	watched          bool
+	stop             chan struct{}
+	stopOnce         sync.Once
 }
 
 const (
 	startDelay         = time.Duration(60) * time.Second
 	monitorSAsInterval = time.Duration(60) * time.Second
+
+	// DefaultFailureThreshold is the default number of consecutive checks
+	// a peer can be without an SA before it's reported as failing
+	DefaultFailureThreshold = 3
 )
 
-// Watch monitors the IPSec SAs and intiates the tunnels if missing
-func Watch(mc metadata.Client) {
-	sm := SAsMonitor{
-		mc: mc,
+// Watch monitors the SAs of the backend and intiates the tunnels if
+// missing. If a tunnel can't be initiated a reconcile of the backend is
+// requested. Peers missing an SA for failureThreshold consecutive checks
+// are reported as failing. The peers going up and down are reported as
+// the backend tells, or from the checks for the backends which can't.
+// The metadata client can be nil, the checks then run whatever the state
+// of the service.
+func Watch(mc metadata.Client, b backend.Backend, failureThreshold int) *SAsMonitor {
+	sm := &SAsMonitor{
+		mc:               mc,
+		backend:          b,
+		failures:         map[string]int{},
+		failureThreshold: failureThreshold,
+		stop:             make(chan struct{}),
+	}
+
+	err := b.WatchPeers(sm.stop, sm.peerUpdown)
+	if err != nil && err != backend.ErrNotSupported {
+		log.Errorf("samonitor: error watching the peers, checking them instead: %v", err)
 	}
+	sm.watched = err == nil
 
 	go sm.monitorSAs()
+	return sm
 }
-func getClient() (*goStrongswanVici.ClientConn, error) {
-	var err error
-	for i := 0; i < 3; i++ {
-		var client *goStrongswanVici.ClientConn
-		client, err = goStrongswanVici.NewClientConnFromDefaultSocket()
-		if err == nil {
-			return client, nil
-		}
 
-		if i > 0 {
-			log.Errorf("Failed to connect to charon: %v", err)
-		}
-		time.Sleep(1 * time.Second)
+// Stop stops the checks, the one in progress completes
+func (sm *SAsMonitor) Stop() {
+	sm.stopOnce.Do(func() {
+		close(sm.stop)
+	})
+}
+
+// sleep waits for d and returns false if the monitor stopped meanwhile
+func (sm *SAsMonitor) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-sm.stop:
+		return false
 	}
+}
 
-	return nil, err
+// peerUpdown publishes the peer going up or down as told by the backend
+func (sm *SAsMonitor) peerUpdown(id string, up bool) {
+	if up {
+		events.Publish(events.PeerUp, peerEventData(id))
+	} else {
+		events.Publish(events.PeerDown, peerEventData(id))
+	}
 }
 
-func buildHostsMap(hosts []metadata.Host, selfHost metadata.Host) map[string]bool {
-	hostsMap := map[string]bool{}
+// updatePeers publishes an event for every host which reached the failure
+// threshold and, unless the backend reports them, for every host whose SA
+// appeared or disappeared since the last check. The first check only
+// seeds the state of the hosts.
+func (sm *SAsMonitor) updatePeers(hostsMap map[string]bool) {
+	seeding := sm.peers == nil
+	failures := map[string]int{}
+	for host, saFound := range hostsMap {
+		if !saFound {
+			failures[host] = sm.failures[host] + 1
+			if failures[host] == sm.failureThreshold {
+				data := peerEventData(host)
+				data["failures"] = strconv.Itoa(failures[host])
+				events.Publish(events.PeerFailing, data)
+			}
+		}
 
-	for _, aHost := range hosts {
-		if aHost.UUID == selfHost.UUID {
+		if up, ok := sm.peers[host]; sm.watched || seeding || ok && up == saFound {
 			continue
 		}
-		hostsMap[aHost.AgentIP] = false
+		sm.peerUpdown(host, saFound)
 	}
+	sm.peers = hostsMap
+	sm.failures = failures
+}
 
-	return hostsMap
+// peerEventData returns the host and, for an additional network, the
+// network of the peer ID
+func peerEventData(id string) map[string]string {
+	host, network := backend.ParsePeerID(id)
+	data := map[string]string{"host": host}
+	if network != "" {
+		data[events.NetworkKey] = network
+	}
+	return data
 }
 
-// This function is used to check the IPSec SAs
+// This function is used to check the SAs of the backend
 // to be present for the existing hosts
 func (sm *SAsMonitor) monitorSAs() {
 	log.Infof("samonitor: sleeping initially for %v", startDelay)
-	time.Sleep(startDelay)
-	log.Infof("samonitor: started monitoring IPSec SAs")
-	for {
-		time.Sleep(monitorSAsInterval)
-		selfService, err := sm.mc.GetSelfService()
-		if err != nil {
-			log.Errorf("samonitor: error fetching self service: %v", err)
-			continue
-		}
-		if selfService.State != "active" {
-			log.Infof("samonitor: skipping as service is not active but in % state", selfService.State)
-			continue
-		}
-
-		hosts, err := sm.mc.GetHosts()
-		if err != nil {
-			log.Errorf("samonitor: error fetching hosts: %v", err)
-			continue
+	if !sm.sleep(startDelay) {
+		return
+	}
+	log.Infof("samonitor: started monitoring SAs")
+	for sm.sleep(monitorSAsInterval) {
+		if sm.mc != nil {
+			selfService, err := sm.mc.GetSelfService()
+			if err != nil {
+				log.Errorf("samonitor: error fetching self service: %v", err)
+				continue
+			}
+			if selfService.State != "active" {
+				log.Infof("samonitor: skipping as service is not active but in %v state", selfService.State)
+				continue
+			}
 		}
 
-		selfHost, err := sm.mc.GetSelfHost()
-		if err != nil {
-			log.Errorf("samonitor: error fetching self host: %v", err)
+		peers, err := sm.backend.Peers()
+		if err == backend.ErrNotSupported {
 			continue
 		}
-
-		hostsMap := buildHostsMap(hosts, selfHost)
-		log.Debugf("samonitor: hostsMap: %v", hostsMap)
-
-		client, err := getClient()
 		if err != nil {
-			log.Errorf("samonitor: error getting strongswan client: %v", err)
+			log.Errorf("samonitor: error getting the peers from the backend: %v", err)
 			continue
 		}
 
-		sas, err := client.ListSas("", "")
-		if err != nil {
-			log.Errorf("samonitor: error getting list of sas from strongswan: %v", err)
-			client.Close()
-			continue
+		// The peers of the additional networks are told apart from
+		// the ones of the agent network by their network
+		hostsMap := map[string]bool{}
+		for _, peer := range peers {
+			log.Debugf("samonitor: peer: %+v", peer)
+			hostsMap[backend.PeerID(peer.Host, peer.Network)] = peer.State != ""
 		}
+		log.Debugf("samonitor: hostsMap: %v", hostsMap)
 
-		for _, aSA := range sas {
-			log.Debugf("samonitor: sa: %+v", aSA)
-			for k, v := range aSA {
-				log.Debugf("samonitor: sa details k=%v, v=%v", k, v)
-				hostsMap[v.Remote_host] = true
-			}
-		}
+		sm.updatePeers(hostsMap)
 
+		initiateFailed := false
 		for host, saFound := range hostsMap {
 			if !saFound {
 				log.Infof("samonitor: expected SA for host: %v, but not found.", host)
-				childSA := fmt.Sprintf("child-%v", host)
-				err := client.Initiate(childSA, "")
+				err := sm.backend.InitiatePeer(host)
+				if err == backend.ErrNotSupported {
+					// The backend sets up the SAs on its
+					// own, there's nothing to initiate
+					continue
+				}
 				if err != nil {
-					log.Errorf("samonitor: error initiating missing SA %v: %v", childSA, err)
+					log.Errorf("samonitor: error initiating missing SA to %v: %v", host, err)
+					initiateFailed = true
 				}
 			}
 		}
-		client.Close()
+
+		if initiateFailed {
+			id := sm.backend.Submit(backend.TriggerMonitor, "")
+			log.Infof("samonitor: requested reconcile, run: %v", id)
+		}
 	}
 }
@@ -3,8 +3,20 @@ set -e -x
 
 trap "exit 1" SIGTERM SIGINT
 
+# The state directory is a volume shared with the container of the previous
+# agent, which hands over its policies and SAs and exits when asked with the
+# token it left there. The agents without handover are waited for until
+# they're stopped.
+# With --charon-launch the charon of the previous agent exits with it, the
+# new one starts empty and negotiates the tunnels to every peer again. The
+# SAs handed over carry the traffic until then and are removed once replaced.
+STATE_DIR=/var/lib/rancher/ipsec
+mkdir -p ${STATE_DIR}
+if [ -f ${STATE_DIR}/handover-token ]; then
+    curl -s -f -X POST -H "X-Handover-Token: $(cat ${STATE_DIR}/handover-token)" \
+        http://localhost:8111/v1/handover >/dev/null 2>&1 || true
+fi
 while curl http://localhost:8111 >/dev/null 2>&1; do
-    # This is an upgrade hack from going from v0.7.5 to something newer
     echo Waiting for old ipsec container to stop
     sleep 2
 done
@@ -53,4 +65,5 @@ exec rancher-ipsec \
 --gcm=$GCM \
 --charon-launch \
 --ipsec-config /etc/ipsec \
+--state-dir ${STATE_DIR} \
 ${DEBUG}
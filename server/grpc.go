@@ -0,0 +1,310 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rancher/ipsec/api"
+	"github.com/rancher/ipsec/arp"
+	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/log"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const unixPrefix = "unix://"
+
+// ListenAndServeGRPC serves the gRPC control API on the specified address,
+// a unix socket for the addresses starting with unix://. The API has no
+// authentication, a TCP address has to be on the loopback interface
+// unless GRPCAllowRemote is set.
+func (s *Server) ListenAndServeGRPC(listen string) error {
+	l, err := grpcListener(listen, s.GRPCAllowRemote)
+	if err != nil {
+		log.Errorf("got error while listening for gRPC: %v", err)
+		return err
+	}
+
+	log.Infof("Listening for gRPC on %s", listen)
+	err = s.newGRPCServer().Serve(l)
+	if err != nil {
+		log.Errorf("got error while serving gRPC: %v", err)
+	}
+	return err
+}
+
+// newGRPCServer creates a gRPC server with the control API registered
+func (s *Server) newGRPCServer() *grpc.Server {
+	g := grpc.NewServer()
+	api.RegisterIPSecServer(g, &grpcServer{
+		backend: s.Backend,
+		arp:     s.ARP,
+	})
+	return g
+}
+
+// grpcListener listens on the unix socket or the TCP address, refusing
+// the TCP addresses reachable from other hosts unless allowRemote
+func grpcListener(listen string, allowRemote bool) (net.Listener, error) {
+	if strings.HasPrefix(listen, unixPrefix) {
+		path := strings.TrimPrefix(listen, unixPrefix)
+		// A socket left over by a previous agent
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return nil, err
+	}
+	if !allowRemote && !isLoopback(host) {
+		return nil, fmt.Errorf("refusing to serve gRPC on %s, not a loopback address", listen)
+	}
+	return net.Listen("tcp", listen)
+}
+
+// isLoopback tells whether the host only resolves to loopback addresses,
+// an empty host listens on all the interfaces
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// grpcServer implements the gRPC control API on top of the backend
+type grpcServer struct {
+	backend backend.Backend
+	arp     map[string]*arp.Proxy
+}
+
+// arpProxy returns the ARP proxy of the network, the one of the agent
+// network when empty
+func (g *grpcServer) arpProxy(network string) (*arp.Proxy, error) {
+	p, ok := g.arp[network]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no ARP proxy for network %q", network)
+	}
+	return p, nil
+}
+
+// peerError maps the errors of controlling a peer to their status code
+func peerError(err error) error {
+	if err == backend.ErrNotSupported {
+		return status.Errorf(codes.Unimplemented, "backend doesn't support controlling peers")
+	}
+	return status.Errorf(codes.FailedPrecondition, "%v", err)
+}
+
+func (g *grpcServer) GetStatus(ctx context.Context, req *api.StatusRequest) (*api.Status, error) {
+	st, err := g.backend.Status()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	return &api.Status{
+		Backend:          st.Backend,
+		LocalHost:        st.LocalHost,
+		LocalSubnet:      st.LocalSubnet,
+		Peers:            int32(st.Peers),
+		EstablishedPeers: int32(st.EstablishedPeers),
+		Policies:         int32(st.Policies),
+	}, nil
+}
+
+func (g *grpcServer) ListPeers(ctx context.Context, req *api.ListPeersRequest) (*api.ListPeersResponse, error) {
+	peers, err := g.backend.Peers()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	resp := &api.ListPeersResponse{}
+	for _, peer := range peers {
+		resp.Peers = append(resp.Peers, &api.Peer{
+			Host:       peer.Host,
+			Connection: peer.Connection,
+			Loaded:     peer.Loaded,
+			State:      peer.State,
+			Entries:    int32(peer.Entries),
+			Interface:  peer.Interface,
+			BytesIn:    peer.BytesIn,
+			BytesOut:   peer.BytesOut,
+			Network:    peer.Network,
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) ListSAs(ctx context.Context, req *api.ListSAsRequest) (*api.ListSAsResponse, error) {
+	sas, err := g.backend.SAs()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	resp := &api.ListSAsResponse{}
+	for _, sa := range sas {
+		resp.Sas = append(resp.Sas, &api.SA{
+			Name:     sa.Name,
+			Host:     sa.Host,
+			State:    sa.State,
+			ReqId:    sa.ReqID,
+			Mode:     sa.Mode,
+			SpiIn:    sa.SPIIn,
+			SpiOut:   sa.SPIOut,
+			BytesIn:  sa.BytesIn,
+			BytesOut: sa.BytesOut,
+			LocalTs:  sa.LocalTS,
+			RemoteTs: sa.RemoteTS,
+			Network:  sa.Network,
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) ListPolicies(ctx context.Context, req *api.ListPoliciesRequest) (*api.ListPoliciesResponse, error) {
+	policies, err := g.backend.Policies()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	resp := &api.ListPoliciesResponse{}
+	for _, policy := range policies {
+		resp.Policies = append(resp.Policies, &api.Policy{
+			Dir:      policy.Dir,
+			Src:      policy.Src,
+			Dst:      policy.Dst,
+			TmplSrc:  policy.TmplSrc,
+			TmplDst:  policy.TmplDst,
+			ReqId:    int32(policy.ReqID),
+			Priority: int32(policy.Priority),
+			Network:  policy.Network,
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) Reload(ctx context.Context, req *api.ReloadRequest) (*api.ReloadResponse, error) {
+	log.Debugf("Received gRPC reload request")
+	return &api.ReloadResponse{
+		RunId: g.backend.Submit(backend.TriggerAPI, ""),
+	}, nil
+}
+
+func (g *grpcServer) ListRuns(ctx context.Context, req *api.ListRunsRequest) (*api.ListRunsResponse, error) {
+	resp := &api.ListRunsResponse{}
+	for _, run := range g.backend.Runs() {
+		r := &api.Run{
+			Id:              run.ID,
+			Trigger:         string(run.Trigger),
+			MetadataVersion: run.MetadataVersion,
+			State:           run.State,
+			Created:         run.Created.Unix(),
+			Duration:        run.Duration,
+			Error:           run.Error,
+			PoliciesAdded:   run.PoliciesAdded,
+			PoliciesRemoved: run.PoliciesRemoved,
+		}
+		if !run.Started.IsZero() {
+			r.Started = run.Started.Unix()
+		}
+		for _, peer := range run.Peers {
+			r.Peers = append(r.Peers, &api.PeerResult{
+				Host:  peer.Host,
+				Error: peer.Error,
+			})
+		}
+		resp.Runs = append(resp.Runs, r)
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) InitiatePeer(ctx context.Context, req *api.PeerRequest) (*api.PeerResponse, error) {
+	id := backend.PeerID(req.Host, req.Network)
+	log.Infof("Initiating tunnel to %s on gRPC request", id)
+	if err := g.backend.InitiatePeer(id); err != nil {
+		return nil, peerError(err)
+	}
+	return &api.PeerResponse{}, nil
+}
+
+func (g *grpcServer) TerminatePeer(ctx context.Context, req *api.PeerRequest) (*api.PeerResponse, error) {
+	id := backend.PeerID(req.Host, req.Network)
+	log.Infof("Terminating tunnel to %s on gRPC request", id)
+	if err := g.backend.TerminatePeer(id); err != nil {
+		return nil, peerError(err)
+	}
+	return &api.PeerResponse{}, nil
+}
+
+func (g *grpcServer) ListARPConflicts(ctx context.Context, req *api.ARPRequest) (*api.ListARPConflictsResponse, error) {
+	p, err := g.arpProxy(req.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.ListARPConflictsResponse{}
+	for _, c := range p.Conflicts() {
+		resp.Conflicts = append(resp.Conflicts, &api.ARPConflict{
+			Ip:                c.IP,
+			Kind:              c.Kind,
+			Interface:         c.Interface,
+			Mac:               c.MAC,
+			HostIp:            c.HostIP,
+			ConflictingHostIp: c.ConflictingHostIP,
+			FirstSeen:         c.FirstSeen.Unix(),
+			LastSeen:          c.LastSeen.Unix(),
+			Count:             int32(c.Count),
+		})
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) GetARPStats(ctx context.Context, req *api.ARPRequest) (*api.ARPStats, error) {
+	p, err := g.arpProxy(req.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.ARPStats{
+		Interfaces: map[string]*api.ARPInterfaceStats{},
+		Conflicts:  p.ConflictCounters(),
+	}
+	for ifaceName, st := range p.Stats() {
+		resp.Interfaces[ifaceName] = &api.ARPInterfaceStats{
+			Filtered:            st.Filtered,
+			Requests:            st.Requests,
+			Replies:             st.Replies,
+			IgnoredLocal:        st.IgnoredLocal,
+			IgnoredUnknown:      st.IgnoredUnknown,
+			IgnoredNotBroadcast: st.IgnoredNotBroadcast,
+			IgnoredConflict:     st.IgnoredConflict,
+			Errors:              st.Errors,
+		}
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) ListARPDecisions(ctx context.Context, req *api.ListARPDecisionsRequest) (*api.ListARPDecisionsResponse, error) {
+	p, err := g.arpProxy(req.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.ListARPDecisionsResponse{}
+	for _, d := range filterDecisions(p.Decisions(), req.Target, req.Requester, req.Interface) {
+		resp.Decisions = append(resp.Decisions, &api.ARPDecision{
+			Time:         d.Time.Unix(),
+			Interface:    d.Interface,
+			RequesterIp:  d.RequesterIP,
+			RequesterMac: d.RequesterMAC,
+			Target:       d.Target,
+			Decision:     d.Decision,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rancher/ipsec/api"
+	"github.com/rancher/ipsec/arp"
+	"github.com/rancher/ipsec/backend"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeBackend serves fixed state, the methods it doesn't override panic
+type fakeBackend struct {
+	backend.Backend
+	submitted []backend.Trigger
+}
+
+func (b *fakeBackend) Status() (backend.Status, error) {
+	return backend.Status{
+		Backend:          "fake",
+		LocalHost:        "10.0.0.1",
+		LocalSubnet:      "10.42.0.0/16",
+		Peers:            2,
+		EstablishedPeers: 1,
+		Policies:         4,
+	}, nil
+}
+
+func (b *fakeBackend) Peers() ([]backend.Peer, error) {
+	return []backend.Peer{
+		{Host: "10.0.0.2", Connection: "conn-10.0.0.2", Loaded: true, State: "ESTABLISHED", Entries: 3},
+		{Host: "10.0.0.3", Connection: "blue-conn-10.0.0.3", Network: "blue"},
+	}, nil
+}
+
+func (b *fakeBackend) Submit(trigger backend.Trigger, version string) string {
+	b.submitted = append(b.submitted, trigger)
+	return "7"
+}
+
+func (b *fakeBackend) InitiatePeer(id string) error {
+	return backend.ErrNotSupported
+}
+
+// serveTestGRPC serves the API of the server on a loopback listener and
+// returns a client connected to it
+func serveTestGRPC(t *testing.T, s *Server) (api.IPSecClient, func()) {
+	l, err := grpcListener("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := s.newGRPCServer()
+	go g.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(5*time.Second))
+	if err != nil {
+		g.Stop()
+		t.Fatal(err)
+	}
+	return api.NewIPSecClient(conn), func() {
+		conn.Close()
+		g.Stop()
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	b := &fakeBackend{}
+	client, cleanup := serveTestGRPC(t, &Server{
+		Backend: b,
+		ARP:     map[string]*arp.Proxy{},
+	})
+	defer cleanup()
+	ctx := context.Background()
+
+	st, err := client.GetStatus(ctx, &api.StatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Backend != "fake" || st.LocalHost != "10.0.0.1" || st.Peers != 2 || st.EstablishedPeers != 1 || st.Policies != 4 {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	peers, err := client.ListPeers(ctx, &api.ListPeersRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers.Peers) != 2 {
+		t.Fatalf("expected 2 peers, got %+v", peers.Peers)
+	}
+	if p := peers.Peers[0]; p.Host != "10.0.0.2" || !p.Loaded || p.State != "ESTABLISHED" || p.Entries != 3 {
+		t.Errorf("unexpected peer %+v", p)
+	}
+	if p := peers.Peers[1]; p.Host != "10.0.0.3" || p.Network != "blue" || p.Loaded {
+		t.Errorf("unexpected peer %+v", p)
+	}
+
+	reload, err := client.Reload(ctx, &api.ReloadRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reload.RunId != "7" || len(b.submitted) != 1 || b.submitted[0] != backend.TriggerAPI {
+		t.Errorf("unexpected run %s, triggers: %v", reload.RunId, b.submitted)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	client, cleanup := serveTestGRPC(t, &Server{
+		Backend: &fakeBackend{},
+		ARP:     map[string]*arp.Proxy{},
+	})
+	defer cleanup()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{
+			name: "peer control not supported",
+			call: func() error {
+				_, err := client.InitiatePeer(ctx, &api.PeerRequest{Host: "10.0.0.2"})
+				return err
+			},
+			code: codes.Unimplemented,
+		},
+		{
+			name: "unknown ARP network",
+			call: func() error {
+				_, err := client.GetARPStats(ctx, &api.ARPRequest{Network: "green"})
+				return err
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "unknown ARP network of the decisions",
+			call: func() error {
+				_, err := client.ListARPDecisions(ctx, &api.ListARPDecisionsRequest{Network: "green"})
+				return err
+			},
+			code: codes.NotFound,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.call()
+		if st, _ := status.FromError(err); err == nil || st.Code() != test.code {
+			t.Errorf("%s: expected %v, got %v", test.name, test.code, err)
+		}
+	}
+}
+
+func TestGRPCListener(t *testing.T) {
+	tests := []struct {
+		listen      string
+		allowRemote bool
+		err         bool
+	}{
+		{listen: "127.0.0.1:0"},
+		{listen: "localhost:0"},
+		{listen: "[::1]:0"},
+		{listen: ":0", err: true},
+		{listen: "0.0.0.0:0", err: true},
+		{listen: "0.0.0.0:0", allowRemote: true},
+		{listen: "127.0.0.1", err: true},
+	}
+
+	for _, test := range tests {
+		l, err := grpcListener(test.listen, test.allowRemote)
+		if test.err {
+			if err == nil {
+				l.Close()
+				t.Errorf("%s: expected an error", test.listen)
+			}
+			continue
+		}
+		if err != nil {
+			// The host may lack IPv6
+			if _, ok := err.(*net.OpError); ok {
+				t.Logf("%s: %v", test.listen, err)
+				continue
+			}
+			t.Errorf("%s: unexpected error: %v", test.listen, err)
+			continue
+		}
+		l.Close()
+	}
+
+	dir, err := ioutil.TempDir("", "grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A socket left over is replaced
+	socket := path.Join(dir, "grpc.sock")
+	if err := ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := grpcListener(unixPrefix+socket, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Addr().Network() != "unix" {
+		t.Errorf("expected a unix socket, got %s", l.Addr().Network())
+	}
+}
@@ -1,16 +1,44 @@
 package server
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/rancher/ipsec/arp"
 	"github.com/rancher/ipsec/backend"
+	"github.com/rancher/ipsec/events"
 	"github.com/rancher/log"
 )
 
+const eventsKeepAliveInterval = 30 * time.Second
+
+// HandoverTokenHeader carries the token a new agent proves it can take
+// over with
+const HandoverTokenHeader = "X-Handover-Token"
+
 // Server structure is used to the store backend information
 type Server struct {
-	Backend backend.Backend
+	Backend  backend.Backend
+	Settings map[string]string
+
+	// ARP holds the ARP proxies by network, the one of the agent network
+	// under the empty name
+	ARP map[string]*arp.Proxy
+
+	// Handover is called when a new agent asks to take over, nil if
+	// handovers aren't allowed. The request has to come from the
+	// loopback interface and carry HandoverToken.
+	Handover      func()
+	HandoverToken string
+
+	// GRPCAllowRemote allows serving the gRPC API on the addresses
+	// reachable from other hosts
+	GRPCAllowRemote bool
 }
 
 // ListenAndServe is used to setup ping and reload handlers and
@@ -18,6 +46,15 @@ type Server struct {
 func (s *Server) ListenAndServe(listen string) error {
 	http.HandleFunc("/ping", s.ping)
 	http.HandleFunc("/v1/reload", s.reload)
+	http.HandleFunc("/v1/handover", s.handover)
+	http.HandleFunc("/v1/runs", s.runs)
+	http.HandleFunc("/v1/runs/", s.run)
+	http.HandleFunc("/v1/events", s.events)
+	http.HandleFunc("/v1/config", s.config)
+	http.HandleFunc("/v1/arp/conflicts", s.arpConflicts)
+	http.HandleFunc("/v1/arp/conflicts/stats", s.arpConflictStats)
+	http.HandleFunc("/v1/arp/stats", s.arpStats)
+	http.HandleFunc("/v1/arp/decisions", s.arpDecisions)
 	log.Infof("Listening on %s", listen)
 	err := http.ListenAndServe(listen, nil)
 	if err != nil {
@@ -33,11 +70,189 @@ func (s *Server) ping(rw http.ResponseWriter, req *http.Request) {
 
 func (s *Server) reload(rw http.ResponseWriter, req *http.Request) {
 	log.Debugf("Received reload request")
-	msg := "Reloaded Configuration\n"
-	if err := s.Backend.Reload(); err != nil {
-		rw.WriteHeader(500)
-		msg = fmt.Sprintf("Failed to reload configuration: %v\n", err)
+	id := s.Backend.Submit(backend.TriggerAPI, "")
+	writeJSON(rw, http.StatusAccepted, map[string]string{
+		"id": id,
+	})
+}
+
+func (s *Server) handover(rw http.ResponseWriter, req *http.Request) {
+	log.Infof("Received handover request")
+	if req.Method != http.MethodPost {
+		http.Error(rw, "handover needs a POST", http.StatusMethodNotAllowed)
+		return
 	}
+	if s.Handover == nil || s.HandoverToken == "" {
+		http.NotFound(rw, req)
+		return
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(rw, "handover is only allowed from the local host", http.StatusForbidden)
+		return
+	}
+	token := req.Header.Get(HandoverTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.HandoverToken)) != 1 {
+		http.Error(rw, "invalid handover token", http.StatusForbidden)
+		return
+	}
+
+	writeJSON(rw, http.StatusAccepted, map[string]string{})
+	s.Handover()
+}
+
+func (s *Server) runs(rw http.ResponseWriter, req *http.Request) {
+	log.Debugf("Received runs request")
+	writeJSON(rw, http.StatusOK, s.Backend.Runs())
+}
+
+func (s *Server) run(rw http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/v1/runs/")
+	log.Debugf("Received run request for %s", id)
+	for _, run := range s.Backend.Runs() {
+		if run.ID == id {
+			writeJSON(rw, http.StatusOK, run)
+			return
+		}
+	}
+
+	http.NotFound(rw, req)
+}
+
+func (s *Server) config(rw http.ResponseWriter, req *http.Request) {
+	log.Debugf("Received config request")
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"settings": s.Settings,
+		"backend":  s.Backend.EffectiveConfig(),
+	})
+}
+
+// arpProxy returns the ARP proxy of the network given by the network query
+// parameter, the one of the agent network when it's not set
+func (s *Server) arpProxy(req *http.Request) *arp.Proxy {
+	return s.ARP[req.URL.Query().Get("network")]
+}
+
+func (s *Server) arpConflicts(rw http.ResponseWriter, req *http.Request) {
+	log.Debugf("Received ARP conflicts request")
+	p := s.arpProxy(req)
+	if p == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	writeJSON(rw, http.StatusOK, p.Conflicts())
+}
 
-	rw.Write([]byte(msg))
+// arpConflictStats returns the number of conflicts detected per kind
+func (s *Server) arpConflictStats(rw http.ResponseWriter, req *http.Request) {
+	log.Debugf("Received ARP conflict stats request")
+	p := s.arpProxy(req)
+	if p == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	writeJSON(rw, http.StatusOK, p.ConflictCounters())
+}
+
+func (s *Server) arpStats(rw http.ResponseWriter, req *http.Request) {
+	log.Debugf("Received ARP stats request")
+	p := s.arpProxy(req)
+	if p == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	writeJSON(rw, http.StatusOK, p.Stats())
+}
+
+// arpDecisions lists the recent decisions of the ARP proxy, oldest
+// first. The optional target, requester and interface query parameters
+// restrict the list to the matching decisions.
+func (s *Server) arpDecisions(rw http.ResponseWriter, req *http.Request) {
+	log.Debugf("Received ARP decisions request")
+	p := s.arpProxy(req)
+	if p == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	query := req.URL.Query()
+	writeJSON(rw, http.StatusOK, filterDecisions(p.Decisions(), query.Get("target"), query.Get("requester"), query.Get("interface")))
+}
+
+// filterDecisions returns the decisions for the target, from the requester
+// IP or MAC address and on the interface, the empty ones matching all
+func filterDecisions(all []arp.Decision, target, requester, iface string) []arp.Decision {
+	decisions := []arp.Decision{}
+	for _, d := range all {
+		if (target != "" && d.Target != target) ||
+			(requester != "" && d.RequesterIP != requester && d.RequesterMAC != requester) ||
+			(iface != "" && d.Interface != iface) {
+			continue
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// events streams the overlay events as server-sent events. The
+// optional type query parameter restricts the stream to the given
+// comma separated event types.
+func (s *Server) events(rw http.ResponseWriter, req *http.Request) {
+	log.Debugf("Received events request from %s", req.RemoteAddr)
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	types := map[string]bool{}
+	for _, t := range strings.Split(req.URL.Query().Get("type"), ",") {
+		if t != "" {
+			types[t] = true
+		}
+	}
+
+	c, cancel := events.Subscribe()
+	defer cancel()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			log.Debugf("Events client %s disconnected", req.RemoteAddr)
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event := <-c:
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Errorf("Failed to marshal event %+v: %v", event, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, obj interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		log.Errorf("Failed to write response: %v", err)
+	}
 }
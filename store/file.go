@@ -0,0 +1,200 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+)
+
+// FileStore reads the entries from a JSON file instead of metadata, for
+// the setups running without Rancher such as tests between network
+// namespaces. The file is read again on every Reload.
+type FileStore struct {
+	sync.Mutex
+
+	Path string
+
+	data              fileData
+	local             map[string]Entry
+	remote            map[string]Entry
+	peersMap          map[string]Entry
+	remoteNonPeersMap map[string]Entry
+}
+
+// fileData is the content of the file of a FileStore
+type fileData struct {
+	Self          Entry   `json:"self"`
+	Entries       []Entry `json:"entries"`
+	LocalSubnet   string  `json:"localSubnet"`
+	LocalSubnetV6 string  `json:"localSubnetV6,omitempty"`
+	LocalBridge   string  `json:"localBridge,omitempty"`
+}
+
+// NewFileStore creates a store reading the entries from the given file
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		Path:              path,
+		local:             map[string]Entry{},
+		remote:            map[string]Entry{},
+		peersMap:          map[string]Entry{},
+		remoteNonPeersMap: map[string]Entry{},
+	}
+}
+
+// Reload reads the file again
+func (fs *FileStore) Reload() error {
+	content, err := ioutil.ReadFile(fs.Path)
+	if err != nil {
+		return err
+	}
+
+	data := fileData{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+
+	local := map[string]Entry{}
+	remote := map[string]Entry{}
+	peersMap := map[string]Entry{}
+	remoteNonPeersMap := map[string]Entry{}
+	for _, e := range data.Entries {
+		ipNoCidr := strings.Split(e.IPAddress, "/")[0]
+		if e.Peer {
+			peersMap[ipNoCidr] = e
+		}
+		if e.HostIPAddress == data.Self.HostIPAddress {
+			local[ipNoCidr] = e
+		} else {
+			remote[ipNoCidr] = e
+			if !e.Peer {
+				remoteNonPeersMap[ipNoCidr] = e
+			}
+		}
+	}
+
+	fs.Lock()
+	oldRemote := fs.remote
+	fs.data = data
+	fs.local = local
+	fs.remote = remote
+	fs.peersMap = peersMap
+	fs.remoteNonPeersMap = remoteNonPeersMap
+	fs.Unlock()
+
+	publishMoves("", oldRemote, local, remote)
+	return nil
+}
+
+// LocalEntry returns the entry of the current agent
+func (fs *FileStore) LocalEntry() Entry {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.data.Self
+}
+
+// LocalHostIPAddress returns the IP address of the host where the agent is running
+func (fs *FileStore) LocalHostIPAddress() string {
+	return fs.LocalEntry().HostIPAddress
+}
+
+// LocalHostIPv6Address returns the IPv6 address of the host where the agent
+// is running, empty when it has none besides LocalHostIPAddress
+func (fs *FileStore) LocalHostIPv6Address() string {
+	return fs.LocalEntry().HostIPv6Address
+}
+
+// LocalIPAddress returns the IP address of the current agent
+func (fs *FileStore) LocalIPAddress() string {
+	ip, _, err := net.ParseCIDR(fs.LocalEntry().IPAddress)
+	if err != nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// LocalIPv6Address returns the IPv6 address of the current agent, empty
+// when it has none
+func (fs *FileStore) LocalIPv6Address() string {
+	ip, _, err := net.ParseCIDR(fs.LocalEntry().IPAddress)
+	if err != nil || ip.To4() != nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// IsRemote is used to check if the given IP addresss is available on the local host or remote
+func (fs *FileStore) IsRemote(ipAddress string) bool {
+	fs.Lock()
+	defer fs.Unlock()
+	if _, ok := fs.local[ipAddress]; ok {
+		return false
+	}
+	_, ok := fs.remote[ipAddress]
+	return ok
+}
+
+// IsLocal is used to check if the given IP address belongs to a container on the local host
+func (fs *FileStore) IsLocal(ipAddress string) bool {
+	fs.Lock()
+	defer fs.Unlock()
+	_, ok := fs.local[ipAddress]
+	return ok
+}
+
+// Entries is used to get all the entries in the database
+func (fs *FileStore) Entries() []Entry {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.data.Entries
+}
+
+// RemoteEntriesMap is used to get a map of all entries which are remote
+func (fs *FileStore) RemoteEntriesMap() map[string]Entry {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.remote
+}
+
+// RemoteNonPeerEntriesMap is used to get a map of all entries which are remote
+func (fs *FileStore) RemoteNonPeerEntriesMap() map[string]Entry {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.remoteNonPeersMap
+}
+
+// PeerEntriesMap is used to get a map of entries with only the peers
+func (fs *FileStore) PeerEntriesMap() map[string]Entry {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.peersMap
+}
+
+// LocalSubnet returns the subnet used for the local network
+func (fs *FileStore) LocalSubnet() string {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.data.LocalSubnet
+}
+
+// LocalSubnetV6 returns the IPv6 subnet used for the local network, empty
+// when the network has no IPv6 addresses
+func (fs *FileStore) LocalSubnetV6() string {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.data.LocalSubnetV6
+}
+
+// LocalBridge returns the bridge of the local network
+func (fs *FileStore) LocalBridge() string {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.data.LocalBridge
+}
+
+// Duplicates returns no duplicate IPs, the entries of the file are
+// expected to be unique
+func (fs *FileStore) Duplicates() map[string]Duplicate {
+	return map[string]Duplicate{}
+}
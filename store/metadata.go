@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/rancher/go-rancher-metadata/metadata"
+	"github.com/rancher/ipsec/events"
 	"github.com/rancher/ipsec/utils"
 	"github.com/rancher/log"
 	pmutils "github.com/rancher/plugin-manager/utils"
@@ -15,12 +16,18 @@ const (
 	metadataURLTemplate = "http://%v/2016-07-29"
 	defaultSubnetPrefix = "/16"
 
+	defaultSubnetPrefixV6 = "/64"
+
 	// DefaultMetadataAddress specifies the default value to use if nothing is specified
 	DefaultMetadataAddress = "169.254.169.250"
 )
 
 // MetadataStore contains information related to metadata client, etc
 type MetadataStore struct {
+	// Network is the name of the network the store holds the entries
+	// of, the one of the agent container when empty
+	Network string
+
 	mc                metadata.Client
 	self              Entry
 	entries           []Entry
@@ -30,23 +37,32 @@ type MetadataStore struct {
 	remoteNonPeersMap map[string]Entry
 	info              *InfoFromMetadata
 	localSubnet       string
+	localSubnetV6     string
+	localBridge       string
+
+	// duplicates are the IPs used on several hosts at the last refresh,
+	// so each one is only reported once
+	duplicates map[string]Duplicate
 }
 
 // InfoFromMetadata stores the information that has been fetched from
 // metadata server
 type InfoFromMetadata struct {
-	region                  string
-	selfContainer           metadata.Container
-	selfHost                metadata.Host
-	selfService             metadata.Service
-	selfNetwork             metadata.Network
-	selfNetworkSubnetPrefix string
-	services                []metadata.Service
-	servicesMapByName       map[string][]*metadata.Service
-	hosts                   []metadata.Host
-	containers              []metadata.Container
-	hostsMap                map[string]metadata.Host
-	networksMap             map[string]metadata.Network
+	region                    string
+	selfContainer             metadata.Container
+	selfHost                  metadata.Host
+	selfService               metadata.Service
+	selfNetwork               metadata.Network
+	selfNetworkSubnetPrefix   string
+	selfNetworkSubnetPrefixV6 string
+	services                  []metadata.Service
+	servicesMapByName         map[string][]*metadata.Service
+	hosts                     []metadata.Host
+	containers                []metadata.Container
+	hostsMap                  map[string]metadata.Host
+	hostRegions               map[string]string
+	hostEnvironments          map[string]string
+	networksMap               map[string]metadata.Network
 }
 
 // RegionsInfo stores the information for regions feature
@@ -55,6 +71,8 @@ type RegionsInfo struct {
 	peersContainers    []metadata.Container
 	nonPeersContainers []metadata.Container
 	hosts              []metadata.Host
+	hostRegions        map[string]string
+	hostEnvironments   map[string]string
 }
 
 // NewMetadataStoreWithClientIP creates, intializes and returns a store for use with a specific Client IP to contact the metadata
@@ -91,11 +109,33 @@ func (ms *MetadataStore) LocalHostIPAddress() string {
 	return ms.self.HostIPAddress
 }
 
+// LocalEntry returns the entry of the current agent
+func (ms *MetadataStore) LocalEntry() Entry {
+	return ms.self
+}
+
+// LocalHostIPv6Address returns the IPv6 address of the host where the agent
+// is running, empty when it has none besides LocalHostIPAddress
+func (ms *MetadataStore) LocalHostIPv6Address() string {
+	return ms.self.HostIPv6Address
+}
+
 // LocalSubnet returns the subnet used for the local network
 func (ms *MetadataStore) LocalSubnet() string {
 	return ms.localSubnet
 }
 
+// LocalSubnetV6 returns the IPv6 subnet used for the local network, empty
+// when the network has no IPv6 addresses
+func (ms *MetadataStore) LocalSubnetV6() string {
+	return ms.localSubnetV6
+}
+
+// LocalBridge returns the bridge of the local network as found in the CNI config
+func (ms *MetadataStore) LocalBridge() string {
+	return ms.localBridge
+}
+
 // LocalIPAddress returns the IP address of the current agent
 func (ms *MetadataStore) LocalIPAddress() string {
 	ip, _, err := net.ParseCIDR(ms.self.IPAddress)
@@ -107,6 +147,24 @@ func (ms *MetadataStore) LocalIPAddress() string {
 	return ip.String()
 }
 
+// LocalIPv6Address returns the IPv6 address of the current agent, empty
+// when it has none
+func (ms *MetadataStore) LocalIPv6Address() string {
+	if ms.info == nil {
+		return ""
+	}
+	if ip := net.ParseIP(ms.info.selfContainer.PrimaryIp); ip != nil && ip.To4() == nil {
+		return ip.String()
+	}
+	for _, e := range ms.getIPv6EntriesFromContainer(ms.info.selfContainer) {
+		ip, _, err := net.ParseCIDR(e.IPAddress)
+		if err == nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
 // IsRemote is used to check if the given IP addresss is available on the local host or remote
 func (ms *MetadataStore) IsRemote(ipAddress string) bool {
 	if _, ok := ms.local[ipAddress]; ok {
@@ -121,6 +179,12 @@ func (ms *MetadataStore) IsRemote(ipAddress string) bool {
 	return ok
 }
 
+// IsLocal is used to check if the given IP address belongs to a container on the local host
+func (ms *MetadataStore) IsLocal(ipAddress string) bool {
+	_, ok := ms.local[ipAddress]
+	return ok
+}
+
 // Entries is used to get all the entries in the database
 func (ms *MetadataStore) Entries() []Entry {
 	return ms.entries
@@ -130,13 +194,35 @@ func (ms *MetadataStore) getEntryFromContainer(c metadata.Container) (Entry, err
 
 	isSelf := (c.PrimaryIp == ms.info.selfContainer.PrimaryIp)
 	isPeer := false
-	hostIP := ms.info.hostsMap[c.HostUUID].AgentIP
+	host := ms.info.hostsMap[c.HostUUID]
+	hostIP := host.AgentIP
+
+	prefix := ms.info.selfNetworkSubnetPrefix
+	if ip := net.ParseIP(c.PrimaryIp); ip != nil && ip.To4() == nil {
+		prefix = ms.info.selfNetworkSubnetPrefixV6
+	}
+
+	region, environment := ms.info.region, host.EnvironmentUUID
+	if r, ok := ms.info.hostRegions[c.HostUUID]; ok {
+		region, environment = r, ms.info.hostEnvironments[c.HostUUID]
+	}
+	if environment == "" {
+		environment = c.EnvironmentUUID
+	}
 
 	entry := Entry{
-		c.PrimaryIp + ms.info.selfNetworkSubnetPrefix,
-		hostIP,
-		isSelf,
-		isPeer,
+		IPAddress:       c.PrimaryIp + prefix,
+		HostIPAddress:   hostIP,
+		Self:            isSelf,
+		Peer:            isPeer,
+		MACAddress:      c.PrimaryMacAddress,
+		HostIPv6Address: host.Labels[HostIPv6Label],
+		HostRegion:      region,
+		HostEnvironment: environment,
+		PrivateEndpoint: host.Labels[PrivateEndpointLabel],
+		PublicEndpoint:  host.Labels[PublicEndpointLabel],
+		HostGroup:       host.Labels[PeerGroupLabel],
+		HostGateway:     host.Labels[GatewayLabel] == "true",
 	}
 
 	if hostIP == "" {
@@ -146,6 +232,29 @@ func (ms *MetadataStore) getEntryFromContainer(c metadata.Container) (Entry, err
 	return entry, nil
 }
 
+// getEntriesFromContainer returns the entry of the primary IP of the
+// container followed by the entries of its IPv6 addresses
+func (ms *MetadataStore) getEntriesFromContainer(c metadata.Container) []Entry {
+	entry, _ := ms.getEntryFromContainer(c)
+	return append([]Entry{entry}, ms.getIPv6EntriesFromContainer(c)...)
+}
+
+func (ms *MetadataStore) getIPv6EntriesFromContainer(c metadata.Container) []Entry {
+	entries := []Entry{}
+	for _, address := range c.Ips {
+		ip := net.ParseIP(strings.Split(address, "/")[0])
+		if ip == nil || ip.To4() != nil || ip.IsLinkLocalUnicast() ||
+			ip.Equal(net.ParseIP(c.PrimaryIp)) {
+			continue
+		}
+
+		entry, _ := ms.getEntryFromContainer(c)
+		entry.IPAddress = ip.String() + ms.info.selfNetworkSubnetPrefixV6
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 // RemoteEntriesMap is used to get a map of all entries which are remote
 func (ms *MetadataStore) RemoteEntriesMap() map[string]Entry {
 	return ms.remote
@@ -185,6 +294,15 @@ func getNetworksMapFromNetworksArray(networks []metadata.Network) map[string]met
 	return networksMap
 }
 
+func getNetworkByName(networks []metadata.Network, name string) (metadata.Network, bool) {
+	for _, aNetwork := range networks {
+		if aNetwork.Name == name {
+			return aNetwork, true
+		}
+	}
+	return metadata.Network{}, false
+}
+
 func (ms *MetadataStore) getLinkedFromServicesToSelf() []*metadata.Service {
 	linkedTo := ms.info.selfService.StackName + "/" + ms.info.selfService.Name
 	log.Debugf("getLinkedFromServicesToSelf linkedTo: %v", linkedTo)
@@ -215,6 +333,8 @@ func (ms *MetadataStore) getRegionsInfo() (*RegionsInfo, error) {
 	var regionPeersContainers []metadata.Container
 	var regionNonPeersContainers []metadata.Container
 	var regionHosts []metadata.Host
+	regionHostRegions := map[string]string{}
+	regionHostEnvironments := map[string]string{}
 	var err error
 
 	environments, err := ms.mc.GetEnvironments()
@@ -226,6 +346,10 @@ func (ms *MetadataStore) getRegionsInfo() (*RegionsInfo, error) {
 
 	for _, aEnvironment := range environments {
 		regionHosts = append(regionHosts, aEnvironment.Hosts...)
+		for _, aHost := range aEnvironment.Hosts {
+			regionHostRegions[aHost.UUID] = aEnvironment.RegionName
+			regionHostEnvironments[aHost.UUID] = aEnvironment.UUID
+		}
 
 		var peerNetwork metadata.Network
 		for _, aNetwork := range aEnvironment.Networks {
@@ -263,6 +387,8 @@ func (ms *MetadataStore) getRegionsInfo() (*RegionsInfo, error) {
 		regionPeersContainers,
 		regionNonPeersContainers,
 		regionHosts,
+		regionHostRegions,
+		regionHostEnvironments,
 	}
 	return info, err
 }
@@ -327,7 +453,8 @@ func (ms *MetadataStore) getLinkedPeersInfo() (map[string]bool, []metadata.Conta
 func (ms *MetadataStore) doInternalRefresh() {
 	log.Debugf("Doing internal refresh")
 
-	seen := map[string]bool{}
+	seen := map[string]string{}
+	duplicates := map[string]Duplicate{}
 	entries := []Entry{}
 	local := map[string]Entry{}
 	remote := map[string]Entry{}
@@ -336,9 +463,11 @@ func (ms *MetadataStore) doInternalRefresh() {
 	peersNetworks, linkedPeersContainers := ms.getLinkedPeersInfo()
 
 	// Add self network to peersNetworks
-	peersNetworks[ms.info.selfContainer.NetworkUUID] = true
+	peersNetworks[ms.info.selfNetwork.UUID] = true
 
 	allHosts := ms.info.hosts
+	ms.info.hostRegions = map[string]string{}
+	ms.info.hostEnvironments = map[string]string{}
 	allContainers := ms.info.containers
 	allPeersContainers := linkedPeersContainers
 
@@ -349,6 +478,8 @@ func (ms *MetadataStore) doInternalRefresh() {
 			log.Errorf("error fetching regions info: %v", err)
 		} else {
 			allHosts = append(allHosts, regionsInfo.hosts...)
+			ms.info.hostRegions = regionsInfo.hostRegions
+			ms.info.hostEnvironments = regionsInfo.hostEnvironments
 			allPeersContainers = append(allPeersContainers, regionsInfo.peersContainers...)
 			for k, v := range regionsInfo.peersNetworks {
 				peersNetworks[k] = v
@@ -369,10 +500,11 @@ func (ms *MetadataStore) doInternalRefresh() {
 	}
 
 	for _, sc := range allPeersContainers {
-		e, _ := ms.getEntryFromContainer(sc)
-		e.Peer = true
-		ipNoCidr := strings.Split(e.IPAddress, "/")[0]
-		peersMap[ipNoCidr] = e
+		for _, e := range ms.getEntriesFromContainer(sc) {
+			e.Peer = true
+			ipNoCidr := strings.Split(e.IPAddress, "/")[0]
+			peersMap[ipNoCidr] = e
+		}
 	}
 
 	for _, c := range allContainers {
@@ -389,31 +521,37 @@ func (ms *MetadataStore) doInternalRefresh() {
 			continue
 		}
 
-		log.Debugf("Getting Entry from Container: %+v", c)
-		e, _ := ms.getEntryFromContainer(c)
-
-		ipNoCidr := strings.Split(e.IPAddress, "/")[0]
+		log.Debugf("Getting Entries from Container: %+v", c)
+		for _, e := range ms.getEntriesFromContainer(c) {
+			ipNoCidr := strings.Split(e.IPAddress, "/")[0]
 
-		if seen[ipNoCidr] {
-			continue
-		}
-		seen[ipNoCidr] = true
+			if hostIP, ok := seen[ipNoCidr]; ok {
+				if hostIP != e.HostIPAddress {
+					duplicates[ipNoCidr] = Duplicate{
+						HostIPAddress:            hostIP,
+						ConflictingHostIPAddress: e.HostIPAddress,
+					}
+				}
+				continue
+			}
+			seen[ipNoCidr] = e.HostIPAddress
 
-		if _, ok := peersMap[ipNoCidr]; ok {
-			e.Peer = true
-		}
+			if _, ok := peersMap[ipNoCidr]; ok {
+				e.Peer = true
+			}
 
-		if e.HostIPAddress == ms.self.HostIPAddress {
-			local[ipNoCidr] = e
-		} else {
-			remote[ipNoCidr] = e
-			if !e.Peer {
-				remoteNonPeersMap[ipNoCidr] = e
+			if e.HostIPAddress == ms.self.HostIPAddress {
+				local[ipNoCidr] = e
+			} else {
+				remote[ipNoCidr] = e
+				if !e.Peer {
+					remoteNonPeersMap[ipNoCidr] = e
+				}
 			}
-		}
 
-		log.Debugf("entry: %+v", e)
-		entries = append(entries, e)
+			log.Debugf("entry: %+v", e)
+			entries = append(entries, e)
+		}
 	}
 
 	log.Debugf("entries: %+v", entries)
@@ -421,11 +559,97 @@ func (ms *MetadataStore) doInternalRefresh() {
 	log.Debugf("local: %+v", local)
 	log.Debugf("remote: %+v", remote)
 
+	oldRemote := ms.remote
+	oldDuplicates := ms.duplicates
+
 	ms.entries = entries
 	ms.peersMap = peersMap
 	ms.local = local
 	ms.remote = remote
 	ms.remoteNonPeersMap = remoteNonPeersMap
+	ms.duplicates = duplicates
+
+	publishMoves(ms.Network, oldRemote, local, remote)
+	publishDuplicates(ms.Network, oldDuplicates, duplicates)
+}
+
+// Duplicates returns the IPs used on several hosts at the last refresh
+func (ms *MetadataStore) Duplicates() map[string]Duplicate {
+	result := map[string]Duplicate{}
+	for ip, d := range ms.duplicates {
+		result[ip] = d
+	}
+	return result
+}
+
+// publishDuplicates reports the duplicate IPs of the network which are
+// new or now on other hosts, and the ones which were resolved. A
+// duplicate is reported once while it lasts.
+func publishDuplicates(network string, oldDuplicates, duplicates map[string]Duplicate) {
+	for ip, d := range duplicates {
+		if old, ok := oldDuplicates[ip]; ok && old == d {
+			continue
+		}
+		log.Errorf("IP %s is used by containers on hosts %s and %s", ip, d.HostIPAddress, d.ConflictingHostIPAddress)
+		events.Publish(events.IPConflict, withNetwork(network, map[string]string{
+			"ip":                ip,
+			"kind":              events.ConflictDuplicate,
+			"hostIp":            d.HostIPAddress,
+			"conflictingHostIp": d.ConflictingHostIPAddress,
+		}))
+	}
+	for ip, d := range oldDuplicates {
+		if _, ok := duplicates[ip]; ok {
+			continue
+		}
+		log.Infof("IP %s is no longer used on several hosts", ip)
+		events.Publish(events.IPConflictResolved, withNetwork(network, map[string]string{
+			"ip":                ip,
+			"kind":              events.ConflictDuplicate,
+			"hostIp":            d.HostIPAddress,
+			"conflictingHostIp": d.ConflictingHostIPAddress,
+		}))
+	}
+}
+
+// publishMoves announces the entries of the network which became remote,
+// either because they are new or moved away from this host, the ones which
+// moved from a remote host to this one and the remote ones which are gone
+func publishMoves(network string, oldRemote, local, remote map[string]Entry) {
+	for ip, e := range remote {
+		if old, ok := oldRemote[ip]; !ok || old.HostIPAddress != e.HostIPAddress {
+			events.Publish(events.EntryRemote, entryEventData(network, ip, e))
+		}
+	}
+	for ip, e := range local {
+		if _, ok := oldRemote[ip]; ok {
+			events.Publish(events.EntryLocal, entryEventData(network, ip, e))
+		}
+	}
+	for ip, e := range oldRemote {
+		_, isRemote := remote[ip]
+		_, isLocal := local[ip]
+		if !isRemote && !isLocal {
+			events.Publish(events.EntryRemoved, entryEventData(network, ip, e))
+		}
+	}
+}
+
+func entryEventData(network, ip string, e Entry) map[string]string {
+	return withNetwork(network, map[string]string{
+		"ip":     ip,
+		"hostIp": e.HostIPAddress,
+		"mac":    e.MACAddress,
+	})
+}
+
+// withNetwork adds the network to the data of an event, the events of the
+// network of the agent have none
+func withNetwork(network string, data map[string]string) map[string]string {
+	if network != "" {
+		data[events.NetworkKey] = network
+	}
+	return data
 }
 
 // getServicesMapByName builds a map indexed by `stack_name/service_name`
@@ -453,24 +677,51 @@ func getServicesMapByName(services []metadata.Service, selfService metadata.Serv
 	return servicesMapByName
 }
 
-func getSubnetPrefixFromNetworkConfig(network metadata.Network) string {
+func getSubnetPrefixFromNetworkConfig(network metadata.Network, key, defaultPrefix string) string {
 	conf, _ := network.Metadata["cniConfig"].(map[string]interface{})
 	for _, file := range conf {
 		props, _ := file.(map[string]interface{})
 		ipamConf, found := props["ipam"].(map[string]interface{})
 		if !found {
 			log.Errorf("couldn't find ipam key in network config")
-			return defaultSubnetPrefix
+			return defaultPrefix
 		}
 
-		sp, found := ipamConf["subnetPrefixSize"].(string)
+		sp, found := ipamConf[key].(string)
 		if !found {
-			log.Debugf("couldn't find subnetPrefixSize in network ipam config")
-			return defaultSubnetPrefix
+			log.Debugf("couldn't find %s in network ipam config", key)
+			return defaultPrefix
 		}
 		return sp
 	}
-	return defaultSubnetPrefix
+	return defaultPrefix
+}
+
+// getBridgeSubnetV6 returns the IPv6 subnet of the bridge from the CNI
+// config, or the one of the IPv6 address of the agent when it's not set
+func getBridgeSubnetV6(network metadata.Network, host metadata.Host, self metadata.Container, prefix string) string {
+	conf, _ := network.Metadata["cniConfig"].(map[string]interface{})
+	for _, file := range conf {
+		file = pmutils.UpdateCNIConfigByKeywords(file, host)
+		props, _ := file.(map[string]interface{})
+		if subnet, _ := props["bridgeSubnetV6"].(string); subnet != "" {
+			return subnet
+		}
+	}
+
+	for _, address := range self.Ips {
+		ip := net.ParseIP(strings.Split(address, "/")[0])
+		if ip == nil || ip.To4() != nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(ip.String() + prefix)
+		if err != nil {
+			log.Errorf("couldn't find the IPv6 subnet of %s: %v", ip, err)
+			return ""
+		}
+		return subnet.String()
+	}
+	return ""
 }
 
 // Reload is used to refresh/reload the data from metadata
@@ -533,21 +784,35 @@ func (ms *MetadataStore) Reload() error {
 		return fmt.Errorf("couldn't find self network in metadata")
 	}
 
-	selfNetworkSubnetPrefix := getSubnetPrefixFromNetworkConfig(selfNetwork)
-	_, ms.localSubnet = pmutils.GetBridgeInfo(selfNetwork, selfHost)
+	// The agent container isn't attached to the other networks, it
+	// can't tell their IPv6 subnet
+	subnetContainer := selfContainer
+	if ms.Network != "" && ms.Network != selfNetwork.Name {
+		selfNetwork, ok = getNetworkByName(networks, ms.Network)
+		if !ok {
+			return fmt.Errorf("couldn't find network %s in metadata", ms.Network)
+		}
+		subnetContainer = metadata.Container{}
+	}
+
+	selfNetworkSubnetPrefix := getSubnetPrefixFromNetworkConfig(selfNetwork, "subnetPrefixSize", defaultSubnetPrefix)
+	selfNetworkSubnetPrefixV6 := getSubnetPrefixFromNetworkConfig(selfNetwork, "subnetPrefixSizeV6", defaultSubnetPrefixV6)
+	ms.localBridge, ms.localSubnet = pmutils.GetBridgeInfo(selfNetwork, selfHost)
+	ms.localSubnetV6 = getBridgeSubnetV6(selfNetwork, selfHost, subnetContainer, selfNetworkSubnetPrefixV6)
 
 	info := &InfoFromMetadata{
-		region:                  region,
-		selfContainer:           selfContainer,
-		selfHost:                selfHost,
-		selfService:             selfService,
-		selfNetwork:             selfNetwork,
-		selfNetworkSubnetPrefix: selfNetworkSubnetPrefix,
-		services:                services,
-		servicesMapByName:       servicesMapByName,
-		hosts:                   hosts,
-		containers:              containers,
-		networksMap:             networksMap,
+		region:                    region,
+		selfContainer:             selfContainer,
+		selfHost:                  selfHost,
+		selfService:               selfService,
+		selfNetwork:               selfNetwork,
+		selfNetworkSubnetPrefix:   selfNetworkSubnetPrefix,
+		selfNetworkSubnetPrefixV6: selfNetworkSubnetPrefixV6,
+		services:                  services,
+		servicesMapByName:         servicesMapByName,
+		hosts:                     hosts,
+		containers:                containers,
+		networksMap:               networksMap,
 	}
 
 	ms.info = info
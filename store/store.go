@@ -1,22 +1,70 @@
 package store
 
+// Host labels read by the store
+const (
+	// HostIPv6Label holds the IPv6 address of the host
+	HostIPv6Label = "io.rancher.host.ipv6_address"
+
+	// PrivateEndpointLabel holds the address the peers in the same region
+	// or environment reach the host on
+	PrivateEndpointLabel = "io.rancher.ipsec.private_endpoint"
+
+	// PublicEndpointLabel holds the address the other peers reach the
+	// host on
+	PublicEndpointLabel = "io.rancher.ipsec.public_endpoint"
+
+	// PeerGroupLabel holds the peer group of the host
+	PeerGroupLabel = "io.rancher.ipsec.peer_group"
+
+	// GatewayLabel marks, when set to "true", the host holding the
+	// tunnels of its region or environment to the other ones
+	GatewayLabel = "io.rancher.ipsec.gateway"
+)
+
 // Entry holds the information for each container
 type Entry struct {
 	IPAddress     string `json:"ip"`
 	HostIPAddress string `json:"hostIp"`
 	Self          bool   `json:"self"`
 	Peer          bool   `json:"peer"`
+	MACAddress    string `json:"mac,omitempty"`
+
+	// HostIPv6Address is the IPv6 address of the host, when it has one
+	// besides HostIPAddress
+	HostIPv6Address string `json:"hostIpv6,omitempty"`
+
+	// Location of the host and the endpoints set through its labels
+	HostRegion      string `json:"hostRegion,omitempty"`
+	HostEnvironment string `json:"hostEnvironment,omitempty"`
+	PrivateEndpoint string `json:"privateEndpoint,omitempty"`
+	PublicEndpoint  string `json:"publicEndpoint,omitempty"`
+	HostGroup       string `json:"hostGroup,omitempty"`
+	HostGateway     bool   `json:"hostGateway,omitempty"`
+}
+
+// Duplicate is an IP used by containers on different hosts, the first one
+// found holds it
+type Duplicate struct {
+	HostIPAddress            string `json:"hostIp"`
+	ConflictingHostIPAddress string `json:"conflictingHostIp"`
 }
 
 // Store defines the interface for the data store
 type Store interface {
+	LocalEntry() Entry
 	LocalHostIPAddress() string
+	LocalHostIPv6Address() string
 	LocalIPAddress() string
+	LocalIPv6Address() string
 	IsRemote(ipAddress string) bool
+	IsLocal(ipAddress string) bool
 	Entries() []Entry
 	RemoteEntriesMap() map[string]Entry
 	RemoteNonPeerEntriesMap() map[string]Entry
 	PeerEntriesMap() map[string]Entry
 	Reload() error
 	LocalSubnet() string
+	LocalSubnetV6() string
+	LocalBridge() string
+	Duplicates() map[string]Duplicate
 }
@@ -0,0 +1,234 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rancher/ipsec/events"
+	"github.com/rancher/log"
+)
+
+const (
+	// SignatureHeader is the header holding the HMAC-SHA256 signature of the payload
+	SignatureHeader = "X-Ipsec-Signature"
+
+	// DefaultAttempts is the default number of delivery attempts per webhook
+	DefaultAttempts = 5
+
+	// DefaultBackoff is the default delay before the first retry
+	DefaultBackoff = time.Second
+
+	// DefaultMaxBackoff is the default upper bound of the delay between retries
+	DefaultMaxBackoff = 30 * time.Second
+
+	queueSize = 100
+)
+
+// NotifiedEvents are the event types delivered to the webhooks
+var NotifiedEvents = map[string]bool{
+	events.PeerUp:          true,
+	events.PeerDown:        true,
+	events.PeerFailing:     true,
+	events.CharonStarted:   true,
+	events.CharonRestarted: true,
+	events.CharonKilled:    true,
+	events.CharonExited:    true,
+}
+
+// Payload is the body posted to the webhooks
+type Payload struct {
+	Source string       `json:"source"`
+	Event  events.Event `json:"event"`
+}
+
+// Notifier posts notifications about overlay incidents to webhooks, signed
+// with the secret
+type Notifier struct {
+	URLs       []string
+	Secret     string
+	Source     string
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Client     *http.Client
+
+	// dispatched is the sequence of the last event queued to the
+	// webhooks, pending the number of deliveries not completed yet
+	lock       sync.Mutex
+	dispatched uint64
+	pending    int
+}
+
+// NewNotifier creates a Notifier for the given webhook URLs
+func NewNotifier(urls []string, secret, source string) *Notifier {
+	return &Notifier{
+		URLs:       urls,
+		Secret:     secret,
+		Source:     source,
+		Attempts:   DefaultAttempts,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Start subscribes to the overlay events and delivers the notified ones
+// to every webhook. Each webhook gets its own queue so a slow receiver
+// doesn't delay the others.
+func (n *Notifier) Start() {
+	queues := []chan events.Event{}
+	for _, url := range n.URLs {
+		q := make(chan events.Event, queueSize)
+		queues = append(queues, q)
+		go n.deliverAll(url, q)
+	}
+
+	c, _ := events.Subscribe()
+	events.OnFlush(n.flush)
+	go func() {
+		for event := range c {
+			if NotifiedEvents[event.Type] {
+				n.dispatch(queues, event)
+			}
+			n.lock.Lock()
+			n.dispatched = event.Seq
+			n.lock.Unlock()
+		}
+	}()
+}
+
+func (n *Notifier) dispatch(queues []chan events.Event, event events.Event) {
+	for i, q := range queues {
+		n.lock.Lock()
+		n.pending++
+		n.lock.Unlock()
+
+		select {
+		case q <- event:
+		default:
+			n.done()
+			log.Errorf("webhook: queue for %s is full, dropping %s event", n.URLs[i], event.Type)
+		}
+	}
+}
+
+func (n *Notifier) done() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.pending--
+}
+
+func (n *Notifier) deliverAll(url string, q <-chan events.Event) {
+	for event := range q {
+		if err := n.Send(url, event); err != nil {
+			log.Errorf("webhook: giving up on %s event for %s: %v", event.Type, url, err)
+		}
+		n.done()
+	}
+}
+
+// flush waits until the deadline for the events up to seq to be delivered
+// to every webhook, or given up on
+func (n *Notifier) flush(seq uint64, deadline time.Time) {
+	for time.Now().Before(deadline) {
+		n.lock.Lock()
+		flushed := n.dispatched >= seq && n.pending == 0
+		n.lock.Unlock()
+		if flushed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Errorf("webhook: timed out delivering the pending events")
+}
+
+// Send posts the event to the webhook, retrying with an exponential
+// backoff until the receiver replies with a 2xx status. A 4xx status
+// won't change on a retry, the event is given up on right away, except
+// for the ones telling to try again later.
+func (n *Notifier) Send(url string, event events.Event) error {
+	body, err := json.Marshal(Payload{
+		Source: n.Source,
+		Event:  event,
+	})
+	if err != nil {
+		return err
+	}
+
+	backoff := n.Backoff
+	for attempt := 1; ; attempt++ {
+		err = n.post(url, body)
+		if err == nil {
+			log.Debugf("webhook: delivered %s event to %s", event.Type, url)
+			return nil
+		}
+		if attempt >= n.Attempts {
+			return err
+		}
+		if statusErr, ok := err.(*statusError); ok && statusErr.permanent() {
+			return err
+		}
+
+		log.Infof("webhook: attempt %d to deliver %s event to %s failed, retrying in %v: %v", attempt, event.Type, url, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > n.MaxBackoff {
+			backoff = n.MaxBackoff
+		}
+	}
+}
+
+func (n *Notifier) post(url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(n.Secret, body))
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return nil
+}
+
+// statusError is a response with a status other than 2xx
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.status)
+}
+
+// permanent tells whether the request fails again when retried: a client
+// error other than a timeout or too many requests
+func (e *statusError) permanent() bool {
+	if e.code == http.StatusRequestTimeout || e.code == http.StatusTooManyRequests {
+		return false
+	}
+	return e.code >= 400 && e.code < 500
+}
+
+// Sign returns the signature of the body as sent in the SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher/ipsec/events"
+)
+
+// receiver records the notifications posted to it, failing the first
+// ones with the given status
+type receiver struct {
+	sync.Mutex
+	failures   int
+	status     int
+	bodies     [][]byte
+	signatures []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(r.status)
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	r.bodies = append(r.bodies, body)
+	r.signatures = append(r.signatures, req.Header.Get(SignatureHeader))
+}
+
+func (r *receiver) received() ([][]byte, []string) {
+	r.Lock()
+	defer r.Unlock()
+	return r.bodies, r.signatures
+}
+
+func TestDelivery(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	n := NewNotifier([]string{server.URL}, "secret", "host-a")
+	n.Start()
+
+	events.Publish(events.PolicyAdded, nil)
+	events.Publish(events.PeerDown, map[string]string{"host": "10.42.0.2"})
+	events.Flush(time.Second)
+
+	bodies, signatures := r.received()
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(bodies))
+	}
+
+	payload := Payload{}
+	if err := json.Unmarshal(bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Source != "host-a" || payload.Event.Type != events.PeerDown || payload.Event.Data["host"] != "10.42.0.2" {
+		t.Errorf("unexpected payload: %s", bodies[0])
+	}
+	if signatures[0] != Sign("secret", bodies[0]) {
+		t.Errorf("unexpected signature: %s", signatures[0])
+	}
+}
+
+func TestRetry(t *testing.T) {
+	r := &receiver{
+		failures: 2,
+		status:   http.StatusServiceUnavailable,
+	}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	n := NewNotifier([]string{server.URL}, "secret", "host-a")
+	n.Backoff = time.Millisecond
+	if err := n.Send(server.URL, events.Event{Type: events.PeerUp}); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies, signatures := r.received()
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(bodies))
+	}
+	if signatures[0] != Sign("secret", bodies[0]) {
+		t.Errorf("unexpected signature: %s", signatures[0])
+	}
+
+	r.Lock()
+	r.failures = 3
+	r.Unlock()
+	n.Attempts = 3
+	if err := n.Send(server.URL, events.Event{Type: events.PeerUp}); err == nil {
+		t.Error("expected an error after the last attempt")
+	}
+}
+
+func TestClientError(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int
+	}{
+		{status: http.StatusBadRequest, attempts: 1},
+		{status: http.StatusUnauthorized, attempts: 1},
+		{status: http.StatusNotFound, attempts: 1},
+		{status: http.StatusRequestTimeout, attempts: 3},
+		{status: http.StatusTooManyRequests, attempts: 3},
+		{status: http.StatusInternalServerError, attempts: 3},
+	}
+
+	for _, test := range tests {
+		r := &receiver{failures: 10, status: test.status}
+		server := httptest.NewServer(r)
+
+		n := NewNotifier([]string{server.URL}, "secret", "host-a")
+		n.Backoff = time.Millisecond
+		n.Attempts = 3
+		if err := n.Send(server.URL, events.Event{Type: events.PeerUp}); err == nil {
+			t.Errorf("%d: expected an error", test.status)
+		}
+		server.Close()
+
+		r.Lock()
+		if attempts := 10 - r.failures; attempts != test.attempts {
+			t.Errorf("%d: expected %d attempts, got %d", test.status, test.attempts, attempts)
+		}
+		r.Unlock()
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+	if got := Sign("secret", []byte("{}")); got != expected {
+		t.Errorf("expected signature %s, got %s", expected, got)
+	}
+}